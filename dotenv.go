@@ -0,0 +1,147 @@
+package opts
+
+import (
+	"fmt"
+	"strings"
+)
+
+//dotenvVar is a single KEY=VALUE from a dotenv file
+type dotenvVar struct {
+	key, value string
+	//single quoted values are not expanded
+	literal bool
+}
+
+//parseDotEnv parses dotenv syntax: KEY=VALUE pairs, one per line,
+//with optional "export" prefixes, # comments, and single or double
+//quoted values (which may span multiple lines). Double quoted values
+//support escapes (\n \t \" \\).
+func parseDotEnv(s string) ([]dotenvVar, error) {
+	vars := []dotenvVar{}
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		num := i + 1
+		l := strings.TrimSpace(lines[i])
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(l, "export ") {
+			l = strings.TrimSpace(l[len("export "):])
+		}
+		eq := strings.IndexByte(l, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", num)
+		}
+		key := strings.TrimSpace(l[:eq])
+		if !validDotEnvKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key '%s'", num, key)
+		}
+		v := strings.TrimLeft(l[eq+1:], " \t")
+		value := ""
+		literal := false
+		if v != "" && (v[0] == '"' || v[0] == '\'') {
+			q := v[0]
+			body := v[1:]
+			for {
+				if end := closingQuote(body, q); end >= 0 {
+					value = body[:end]
+					if rest := strings.TrimSpace(body[end+1:]); rest != "" && rest[0] != '#' {
+						return nil, fmt.Errorf("line %d: unexpected text after quoted value", num)
+					}
+					break
+				}
+				//quoted values can span multiple lines
+				i++
+				if i == len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated quoted value", num)
+				}
+				body += "\n" + lines[i]
+			}
+			if q == '"' {
+				value = unescapeDotEnv(value)
+			} else {
+				literal = true
+			}
+		} else {
+			//unquoted values may have trailing comments
+			if c := strings.Index(v, " #"); c >= 0 {
+				v = v[:c]
+			}
+			value = strings.TrimSpace(v)
+		}
+		vars = append(vars, dotenvVar{key: key, value: value, literal: literal})
+	}
+	return vars, nil
+}
+
+func validDotEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//closingQuote returns the index of the closing quote q,
+//skipping escaped double quotes
+func closingQuote(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		if q == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == q {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotEnv(s string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case '"', '\\':
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+//expandDotEnv replaces each ${VAR} in s using lookup
+func expandDotEnv(s string, lookup func(string) string) string {
+	sb := strings.Builder{}
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end == -1 {
+			break
+		}
+		sb.WriteString(s[:start])
+		sb.WriteString(lookup(s[start+2 : start+end]))
+		s = s[start+end+1:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package opts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	vars, err := parseDotEnv(`
+# a comment
+FOO=bar
+export PORT = 8080
+EMPTY=
+SPACED=  hello world  # trailing comment
+SINGLE='raw \n $value'
+DOUBLE="line1\nline2 \"quoted\""
+MULTI="first
+second"
+HASH="a # b"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []dotenvVar{
+		{"FOO", "bar", false},
+		{"PORT", "8080", false},
+		{"EMPTY", "", false},
+		{"SPACED", "hello world", false},
+		{"SINGLE", `raw \n $value`, true},
+		{"DOUBLE", "line1\nline2 \"quoted\"", false},
+		{"MULTI", "first\nsecond", false},
+		{"HASH", "a # b", false},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("expected: %+v\n     got: %+v", expected, vars)
+	}
+}
+
+func TestParseDotEnvErrors(t *testing.T) {
+	for _, testcase := range []struct {
+		input string
+		err   string
+	}{
+		{"FOO", "line 1: expected KEY=VALUE"},
+		{"\nBAD KEY=1", "line 2: invalid key 'BAD KEY'"},
+		{`FOO="bar`, "line 1: unterminated quoted value"},
+		{`FOO="bar" baz`, "line 1: unexpected text after quoted value"},
+	} {
+		_, err := parseDotEnv(testcase.input)
+		if err == nil || err.Error() != testcase.err {
+			t.Fatalf("input: %s\n  expected: %s\n       got: %v", testcase.input, testcase.err, err)
+		}
+	}
+}
+
+func TestExpandDotEnv(t *testing.T) {
+	vars := map[string]string{"HOST": "localhost", "PORT": "80"}
+	lookup := func(k string) string { return vars[k] }
+	for in, out := range map[string]string{
+		"http://${HOST}:${PORT}/": "http://localhost:80/",
+		"${MISSING}x":             "x",
+		"$HOST ${HOST":            "$HOST ${HOST",
+	} {
+		if got := expandDotEnv(in, lookup); got != out {
+			t.Fatalf("input: %s\n  expected: %s\n       got: %s", in, out, got)
+		}
+	}
+}
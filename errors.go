@@ -0,0 +1,311 @@
+package opts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrHelp is wrapped by the HelpError returned by
+//ParseArgsError when help is requested
+var ErrHelp = errors.New("help requested")
+
+//ErrVersion is wrapped by the HelpError returned by
+//ParseArgsError when the version is requested
+var ErrVersion = errors.New("version requested")
+
+//ErrDumpConfig is wrapped by the error returned by ParseArgsError
+//when --dump-config is requested, the error message is the config
+var ErrDumpConfig = errors.New("dump config requested")
+
+//ErrCompletion is wrapped by the error returned by ParseArgsError
+//when --install or --uninstall is requested, the error message
+//is the result
+var ErrCompletion = errors.New("completion install requested")
+
+//HelpError is returned when help (ErrHelp) or the version
+//(ErrVersion) is requested, the error message is the text
+//to print. Opts is the command whose help was requested.
+type HelpError struct {
+	Opts ParsedOpts
+	//Err is ErrHelp or ErrVersion
+	Err error
+	msg string
+}
+
+func (e *HelpError) Error() string {
+	return e.msg
+}
+
+func (e *HelpError) Unwrap() error {
+	return e.Err
+}
+
+//AuthorError is a mistake in the program's use of opts,
+//such as an invalid struct tag, rather than a user error
+type AuthorError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	Msg  string
+}
+
+func (e *AuthorError) Error() string {
+	return e.Msg
+}
+
+//UnknownFlagError is a flag which does not exist
+type UnknownFlagError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	//Flag is the flag as provided, such as --foo or -f
+	Flag string
+	//msg overrides the default message
+	msg string
+}
+
+func (e *UnknownFlagError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return "unknown flag: " + e.Flag
+}
+
+//UnknownCommandError is a command which does not exist
+type UnknownCommandError struct {
+	//Opts is the command which failed
+	Opts    ParsedOpts
+	Command string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("command '%s' does not exist", e.Command)
+}
+
+//UnexpectedArgsError is a set of arguments
+//which were not used by any command
+type UnexpectedArgsError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	Args []string
+}
+
+func (e *UnexpectedArgsError) Error() string {
+	return "unexpected arguments: " + strings.Join(e.Args, " ")
+}
+
+//MissingArgError is a required argument which was not
+//provided, or an argument list with too few values
+type MissingArgError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	Arg  string
+	//msg overrides the default message
+	msg string
+}
+
+func (e *MissingArgError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("argument '%s' is missing", e.Arg)
+}
+
+//MissingFlagError is a set of required flags
+//which were not provided by any source
+type MissingFlagError struct {
+	//Opts is the command which failed
+	Opts  ParsedOpts
+	Flags []string
+}
+
+func (e *MissingFlagError) Error() string {
+	if len(e.Flags) == 1 {
+		return "missing required flag: --" + e.Flags[0]
+	}
+	return "missing required flags: --" + strings.Join(e.Flags, ", --")
+}
+
+//InvalidValueError is a flag or argument value which could
+//not be set or failed validation. Value is empty when the
+//resulting value failed validation.
+type InvalidValueError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	//Flag is the name of the flag or argument
+	Flag  string
+	Value string
+	Err   error
+	//msg describes where the value came from
+	msg string
+}
+
+func (e *InvalidValueError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("invalid value %q for '%s': %s", e.Value, e.Flag, e.Err)
+}
+
+func (e *InvalidValueError) Unwrap() error {
+	return e.Err
+}
+
+//ConstraintError is a set of flags which were used together
+//incorrectly, see the requires, xor, oneof and file keys
+type ConstraintError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	//Flags are the names of the flags involved
+	Flags []string
+	msg   string
+}
+
+func (e *ConstraintError) Error() string {
+	return e.msg
+}
+
+//ConfigError is a config or dotenv file which could not be
+//loaded, or a config key which could not be used. File is
+//empty for errors about a config key.
+type ConfigError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	File string
+	Key  string
+	Err  error
+	msg  string
+}
+
+func (e *ConfigError) Error() string {
+	return e.msg
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+//ValidateError is an error returned by
+//the Validate method of a struct
+type ValidateError struct {
+	//Opts is the command which failed
+	Opts ParsedOpts
+	Err  error
+}
+
+func (e *ValidateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidateError) Unwrap() error {
+	return e.Err
+}
+
+//optsError is implemented by errors which carry
+//the command that failed
+type optsError interface {
+	error
+	setOpts(n *node)
+	opts() ParsedOpts
+}
+
+func (e *HelpError) setOpts(n *node)           { e.Opts = orOpts(e.Opts, n) }
+func (e *AuthorError) setOpts(n *node)         { e.Opts = orOpts(e.Opts, n) }
+func (e *UnknownFlagError) setOpts(n *node)    { e.Opts = orOpts(e.Opts, n) }
+func (e *UnknownCommandError) setOpts(n *node) { e.Opts = orOpts(e.Opts, n) }
+func (e *UnexpectedArgsError) setOpts(n *node) { e.Opts = orOpts(e.Opts, n) }
+func (e *MissingArgError) setOpts(n *node)     { e.Opts = orOpts(e.Opts, n) }
+func (e *MissingFlagError) setOpts(n *node)    { e.Opts = orOpts(e.Opts, n) }
+func (e *InvalidValueError) setOpts(n *node)   { e.Opts = orOpts(e.Opts, n) }
+func (e *ConstraintError) setOpts(n *node)     { e.Opts = orOpts(e.Opts, n) }
+func (e *ConfigError) setOpts(n *node)         { e.Opts = orOpts(e.Opts, n) }
+func (e *ValidateError) setOpts(n *node)       { e.Opts = orOpts(e.Opts, n) }
+
+func (e *HelpError) opts() ParsedOpts           { return e.Opts }
+func (e *AuthorError) opts() ParsedOpts         { return e.Opts }
+func (e *UnknownFlagError) opts() ParsedOpts    { return e.Opts }
+func (e *UnknownCommandError) opts() ParsedOpts { return e.Opts }
+func (e *UnexpectedArgsError) opts() ParsedOpts { return e.Opts }
+func (e *MissingArgError) opts() ParsedOpts     { return e.Opts }
+func (e *MissingFlagError) opts() ParsedOpts    { return e.Opts }
+func (e *InvalidValueError) opts() ParsedOpts   { return e.Opts }
+func (e *ConstraintError) opts() ParsedOpts     { return e.Opts }
+func (e *ConfigError) opts() ParsedOpts         { return e.Opts }
+func (e *ValidateError) opts() ParsedOpts       { return e.Opts }
+
+//orOpts keeps the first command to be set, since
+//errors pass up from subcommands to their parents
+func orOpts(o ParsedOpts, n *node) ParsedOpts {
+	if o != nil {
+		return o
+	}
+	return n
+}
+
+//errorNode returns the command which failed,
+//or n if the error does not carry one
+func errorNode(err error, n *node) *node {
+	if oe, ok := err.(optsError); ok {
+		if on, ok := oe.opts().(*node); ok {
+			return on
+		}
+	}
+	return n
+}
+
+//invalidValue wraps err from setting an item
+func invalidValue(i *item, value string, err error, format string, args ...interface{}) *InvalidValueError {
+	return &InvalidValueError{
+		Flag:  i.name,
+		Value: value,
+		Err:   err,
+		msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+//constraint is a ConstraintError of the given flags
+func constraint(names []string, format string, args ...interface{}) *ConstraintError {
+	return &ConstraintError{Flags: names, msg: fmt.Sprintf(format, args...)}
+}
+
+func itemNames(items []*item) []string {
+	names := make([]string, len(items))
+	for j, i := range items {
+		names[j] = i.name
+	}
+	return names
+}
+
+//configError is a ConfigError of the given file or key
+func configError(file, key string, err error, format string, args ...interface{}) *ConfigError {
+	return &ConfigError{File: file, Key: key, Err: err, msg: fmt.Sprintf(format, args...)}
+}
+
+//exitOkError is output, such as the config, which
+//should be printed before exiting with 0
+type exitOkError struct {
+	err error //ErrDumpConfig
+	msg string
+}
+
+func (e *exitOkError) Error() string {
+	return e.msg
+}
+
+func (e *exitOkError) Unwrap() error {
+	return e.err
+}
+
+//exitError is output which should be
+//printed before exiting with 1
+type exitError struct {
+	err error //ErrCompletion
+	msg string
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
@@ -5,7 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 //item group represents a single "Options" block
@@ -31,22 +36,71 @@ type item struct {
 	val       reflect.Value
 	mode      string
 	name      string
+	fieldName string
 	shortName string
 	envName   string
 	useEnv    bool
 	help      string
 	defstr    string
 	slice     bool
-	min, max  int //valid if slice
+	mapping   bool
+	append    bool   //valid if slice or mapping
+	sep       string //valid if slice or mapping
+	kvsep     string //valid if mapping
+	dup       string //valid if mapping
+	min, max  int    //valid if slice or counter
 	noarg     bool
+	negatable bool
+	counter   bool
+	required  bool
+	internal  bool
+	fileRef   bool  //values may be @path
+	fileFor   *item //this is the --<name>-file flag of fileFor
+	//flag dependencies
+	requiresNames, impliesNames []string
+	requires, implies           []*item
+	//value validation
+	rules     rules
+	choices   []string
 	completer Completer
 	sets      int
+	source    Source
+	//source of each map entry, valid if mapping
+	entrySources map[interface{}]Source
+	//pointer fields are assigned alloc once set
+	ptr, alloc reflect.Value
+	//struct field, checked for a Validator
+	field reflect.Value
+	//state before any flag, env or config values were applied
+	initial *itemState
+	//state after command-line flags were applied
+	flagged *itemState
 }
 
 func newItem(val reflect.Value) (*item, error) {
 	if !val.IsValid() {
 		return nil, fmt.Errorf("invalid value")
 	}
+	//pointer fields are only allocated once set,
+	//so that nil means the field was not provided.
+	//a default pointer is copied, and never modified
+	//since it may be shared.
+	if val.Kind() == reflect.Ptr && val.CanSet() {
+		if val.Type().Elem().Kind() == reflect.Ptr {
+			return nil, fmt.Errorf("field type not supported: %s", val.Type())
+		}
+		alloc := reflect.New(val.Type().Elem())
+		if !val.IsNil() {
+			alloc.Elem().Set(val.Elem())
+		}
+		i, err := newItem(alloc.Elem())
+		if err != nil {
+			return nil, err
+		}
+		i.ptr = val
+		i.alloc = alloc
+		return i, nil
+	}
 	i := &item{}
 	supported := false
 	//take interface value V
@@ -78,6 +132,12 @@ func newItem(val reflect.Value) (*item, error) {
 	if c, ok := v.(Completer); ok {
 		i.completer = c
 	}
+	//implements chooser?
+	for _, t := range []interface{}{v, pv} {
+		if c, ok := t.(Chooser); ok {
+			i.choices = c.Choices()
+		}
+	}
 	//val must be concrete at this point
 	if val.Kind() == reflect.Ptr {
 		val = val.Elem()
@@ -85,28 +145,23 @@ func newItem(val reflect.Value) (*item, error) {
 	//lock in val
 	i.val = val
 	i.slice = val.Kind() == reflect.Slice
-	//prevent defaults on slices (should vals be appended? should it be reset? how to display defaults?)
-	if i.slice && val.Len() > 0 {
-		return nil, fmt.Errorf("slices cannot have default values")
-	}
+	i.mapping = val.Kind() == reflect.Map
 	//type checks
 	t := i.elemType()
 	if t.Kind() == reflect.Ptr {
 		return nil, fmt.Errorf("slice elem (%s) cannot be a pointer", t.Kind())
 	} else if i.slice && t.Kind() == reflect.Bool {
 		return nil, fmt.Errorf("slice of bools not supported")
+	} else if i.mapping && (!isScalar(val.Type().Key().Kind()) || !isScalar(t.Kind())) {
+		return nil, fmt.Errorf("field type not supported: %s", val.Type())
 	}
-	switch t.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-		reflect.Float32, reflect.Float64,
-		reflect.String, reflect.Bool:
+	if isScalar(t.Kind()) {
 		supported = true
 	}
 	//use the inner bool flag, if defined, otherwise if bool
 	if bf, ok := v.(interface{ IsBoolFlag() bool }); ok {
 		i.noarg = bf.IsBoolFlag()
-	} else if t.Kind() == reflect.Bool {
+	} else if t.Kind() == reflect.Bool && !i.mapping {
 		i.noarg = true
 	}
 	if !supported {
@@ -115,13 +170,44 @@ func newItem(val reflect.Value) (*item, error) {
 	return i, nil
 }
 
+func isScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.String, reflect.Bool:
+		return true
+	}
+	return false
+}
+
 func (i *item) set() bool {
 	return i.sets != 0
 }
 
+//setSource records where the current value came from
+func (i *item) setSource(s Source) {
+	i.source = s
+	if i.mapping {
+		i.entrySources = map[interface{}]Source{}
+		for _, k := range i.val.MapKeys() {
+			i.entrySources[k.Interface()] = s
+		}
+	}
+}
+
+//markSet records a successful set, and assigns
+//pointer fields now that they have a value
+func (i *item) markSet() {
+	i.sets++
+	if i.ptr.IsValid() && i.ptr.Pointer() != i.alloc.Pointer() {
+		i.ptr.Set(i.alloc)
+	}
+}
+
 func (i *item) elemType() reflect.Type {
 	t := i.val.Type()
-	if i.slice {
+	if i.slice || i.mapping {
 		t = t.Elem()
 	}
 	return t
@@ -138,11 +224,67 @@ func (i *item) String() string {
 	return fmt.Sprintf("%v", v)
 }
 
+//setFlag sets a value from the command-line, where @path
+//reads the value from a file, and @@ escapes a literal @.
+//env and config values are never read from files.
+func (i *item) setFlag(s string) error {
+	if i.fileRef && strings.HasPrefix(s, "@") {
+		if strings.HasPrefix(s, "@@") {
+			s = s[1:]
+		} else {
+			v, err := readValueFile(s[1:])
+			if err != nil {
+				return err
+			}
+			s = v
+		}
+	}
+	return i.Set(s)
+}
+
 func (i *item) Set(s string) error {
+	//counters can be set explicitly, any number of times
+	if i.counter {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		return i.setCount(n)
+	}
+	//delimited values set each part
+	if i.sep != "" {
+		return i.setAll(splitEscaped(s, i.sep))
+	}
+	return i.setAll([]string{s})
+}
+
+//setAll sets each value in order, the first
+//value replaces the default slice or map
+func (i *item) setAll(vs []string) error {
+	if i.sets == 0 && (i.slice || i.mapping) && i.val.Len() > 0 {
+		i.resetDefault()
+	}
+	for _, v := range vs {
+		if err := i.setSingle(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *item) setSingle(s string) error {
+	//maps insert key-value pairs
+	if i.mapping {
+		return i.setEntry(s)
+	}
 	//can only set singles once
 	if i.sets != 0 && !i.slice {
 		return errors.New("already set")
 	}
+	//restricted to a set of choices?
+	if err := i.checkChoice(s); err != nil {
+		return err
+	}
 	//set has two modes, slice and inplace.
 	// when slice, create a new zero value, scan into it, append to slice
 	// when inplace, take pointer, scan into it
@@ -154,6 +296,170 @@ func (i *item) Set(s string) error {
 	} else {
 		elem = i.val //possibly interface type
 	}
+	if err := scan(elem, s); err != nil {
+		return err
+	}
+	//slice? append!
+	if i.slice {
+		//no pointer elems
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		//append!
+		i.val.Set(reflect.Append(i.val, elem))
+	}
+	//mark item as set!
+	i.markSet()
+	//done
+	return nil
+}
+
+//reset clears a value provided by a lower precedence
+//source, so that it can be replaced
+func (i *item) reset() {
+	if i.slice {
+		i.val.Set(reflect.MakeSlice(i.val.Type(), 0, 0))
+	} else if i.mapping {
+		i.val.Set(reflect.MakeMap(i.val.Type()))
+	}
+	i.sets = 0
+}
+
+//resetDefault replaces the default slice or map with an
+//empty one, or with a copy when appending to the default.
+//the default is never modified since it may be shared.
+func (i *item) resetDefault() {
+	t := i.val.Type()
+	if i.slice {
+		n := 0
+		if i.append {
+			n = i.val.Len()
+		}
+		s := reflect.MakeSlice(t, n, n)
+		reflect.Copy(s, i.val)
+		i.val.Set(s)
+	} else {
+		m := reflect.MakeMap(t)
+		if i.append {
+			iter := i.val.MapRange()
+			for iter.Next() {
+				m.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		i.val.Set(m)
+	}
+}
+
+//defaultString formats the default slice or map
+func (i *item) defaultString() string {
+	sep := i.sep
+	if sep == "" {
+		sep = ","
+	}
+	parts := []string{}
+	if i.slice {
+		for j := 0; j < i.val.Len(); j++ {
+			parts = append(parts, fmt.Sprintf("%v", i.val.Index(j).Interface()))
+		}
+	} else {
+		kvsep := i.kvSep()
+		iter := i.val.MapRange()
+		for iter.Next() {
+			parts = append(parts, fmt.Sprintf("%v%s%v", iter.Key().Interface(), kvsep, iter.Value().Interface()))
+		}
+		sort.Strings(parts)
+	}
+	return strings.Join(parts, sep)
+}
+
+//kvSep is the separator between map keys and values
+func (i *item) kvSep() string {
+	if i.kvsep == "" {
+		return "="
+	}
+	return i.kvsep
+}
+
+//setConfig sets a value decoded from a config file,
+//lists and objects are converted into multiple values
+func (i *item) setConfig(v interface{}) error {
+	switch v := v.(type) {
+	case []interface{}:
+		if !i.slice {
+			return errors.New("expected a single value, got a list")
+		}
+		vs := make([]string, len(v))
+		for j, e := range v {
+			vs[j] = configString(e)
+		}
+		return i.setAll(vs)
+	case map[string]interface{}:
+		if !i.mapping {
+			return errors.New("expected a single value, got an object")
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		vs := make([]string, len(keys))
+		for j, k := range keys {
+			vs[j] = k + i.kvSep() + configString(v[k])
+		}
+		return i.setAll(vs)
+	}
+	return i.Set(configString(v))
+}
+
+func configString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+//setEntry splits s into a key and a value,
+//and inserts them into the map
+func (i *item) setEntry(s string) error {
+	kvsep := i.kvSep()
+	index := strings.Index(s, kvsep)
+	if index == -1 {
+		return fmt.Errorf("expected key%svalue", kvsep)
+	}
+	ks, vs := s[:index], s[index+len(kvsep):]
+	if err := i.checkChoice(vs); err != nil {
+		return err
+	}
+	t := i.val.Type()
+	k := reflect.New(t.Key())
+	if err := scan(k, ks); err != nil {
+		return fmt.Errorf("key %s", err)
+	}
+	v := reflect.New(t.Elem())
+	if err := scan(v, vs); err != nil {
+		return fmt.Errorf("value %s", err)
+	}
+	if i.val.IsNil() {
+		i.val.Set(reflect.MakeMap(t))
+	} else if existing := i.val.MapIndex(k.Elem()); existing.IsValid() {
+		switch i.dup {
+		case "error":
+			return fmt.Errorf("duplicate key '%s'", ks)
+		case "first":
+			i.markSet()
+			return nil
+		}
+	}
+	i.val.SetMapIndex(k.Elem(), v.Elem())
+	i.markSet()
+	return nil
+}
+
+//scan converts the string s into the value pointed to by elem
+func scan(elem reflect.Value, s string) error {
 	v := elem.Interface()
 	//convert string into value
 	if fv, ok := v.(Setter); ok {
@@ -186,21 +492,39 @@ func (i *item) Set(s string) error {
 	} else {
 		return errors.New("could not be set")
 	}
-	//slice? append!
-	if i.slice {
-		//no pointer elems
-		if elem.Kind() == reflect.Ptr {
-			elem = elem.Elem()
-		}
-		//append!
-		i.val.Set(reflect.Append(i.val, elem))
+	return nil
+}
+
+//inc increments a counter item
+func (i *item) inc() error {
+	return i.setCount(i.val.Int() + 1)
+}
+
+func (i *item) setCount(n int64) error {
+	if n < 0 {
+		return errors.New("count cannot be negative")
+	} else if i.max != 0 && n > int64(i.max) {
+		return fmt.Errorf("exceeds max count (%d)", i.max)
+	} else if i.val.OverflowInt(n) {
+		return fmt.Errorf("count overflows %s", i.val.Type())
 	}
-	//mark item as set!
-	i.sets++
-	//done
+	i.val.SetInt(n)
+	i.markSet()
 	return nil
 }
 
+func (i *item) checkChoice(s string) error {
+	if len(i.choices) == 0 {
+		return nil
+	}
+	for _, c := range i.choices {
+		if s == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of: %s", strings.Join(i.choices, ", "))
+}
+
 //IsBoolFlag implements the hidden interface
 //documented here https://golang.org/pkg/flag/#Value
 func (i *item) IsBoolFlag() bool {
@@ -229,6 +553,15 @@ func (t textValue) Set(s string) error {
 	return t.UnmarshalText([]byte(s))
 }
 
+func (t textValue) String() string {
+	if m, ok := t.TextUnmarshaler.(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("%v", t.TextUnmarshaler)
+}
+
 //binaryValue wraps marshaller into a setter
 type binaryValue struct {
 	encoding.BinaryUnmarshaler
@@ -238,6 +571,10 @@ func (t binaryValue) Set(s string) error {
 	return t.UnmarshalBinary([]byte(s))
 }
 
+func (t binaryValue) String() string {
+	return fmt.Sprintf("%v", t.BinaryUnmarshaler)
+}
+
 //borrowed from the stdlib :)
 type durationValue time.Duration
 
@@ -253,3 +590,238 @@ func (d *durationValue) Set(s string) error {
 	*d = durationValue(v)
 	return nil
 }
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
+
+//itemState is a copy of an item's value and source
+type itemState struct {
+	val     reflect.Value
+	str     string
+	sets    int
+	source  Source
+	entries map[interface{}]Source
+	ptr     reflect.Value //field of a pointer item
+}
+
+//snapshot copies the current state of the item. values which
+//wrap a reference to the field are copied via their string form.
+func (i *item) snapshot() *itemState {
+	s := &itemState{
+		sets:   i.sets,
+		source: i.source,
+	}
+	if i.ptr.IsValid() {
+		s.ptr = reflect.ValueOf(i.ptr.Interface())
+	}
+	if i.entrySources != nil {
+		s.entries = map[interface{}]Source{}
+		for k, v := range i.entrySources {
+			s.entries[k] = v
+		}
+	}
+	switch i.val.Interface().(type) {
+	case textValue, binaryValue:
+		s.str = i.String()
+	default:
+		s.val = copyValue(i.val)
+	}
+	return s
+}
+
+//restore returns the item to the given state
+func (i *item) restore(s *itemState) error {
+	if s.val.IsValid() {
+		i.val.Set(copyValue(s.val))
+	} else {
+		i.sets = 0
+		if err := i.Set(s.str); err != nil {
+			return err
+		}
+	}
+	i.sets = s.sets
+	i.source = s.source
+	i.entrySources = nil
+	if s.entries != nil {
+		i.entrySources = map[interface{}]Source{}
+		for k, v := range s.entries {
+			i.entrySources[k] = v
+		}
+	}
+	if i.ptr.IsValid() {
+		i.ptr.Set(s.ptr)
+	}
+	return nil
+}
+
+//copyValue copies v, including the contents of slices and maps
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Slice:
+		if !v.IsNil() {
+			c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			reflect.Copy(c, v)
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			c.Set(reflect.MakeMap(v.Type()))
+			for _, k := range v.MapKeys() {
+				c.SetMapIndex(k, v.MapIndex(k))
+			}
+		}
+	default:
+		c.Set(v)
+	}
+	return c
+}
+
+//rules validate the value of an item
+type rules struct {
+	min, max       *float64
+	minStr, maxStr string
+	pattern        *regexp.Regexp
+	len            bool
+	minLen, maxLen int //maxLen is unbounded when negative
+	nonempty       bool
+}
+
+var durationType = reflect.TypeOf(durationValue(0))
+
+func (i *item) numeric() bool {
+	switch i.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+//parseNumber parses a bound, where durations use duration syntax
+func (i *item) parseNumber(s string) (float64, error) {
+	if i.val.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (i *item) number() float64 {
+	switch i.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(i.val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(i.val.Uint())
+	}
+	return i.val.Float()
+}
+
+func (i *item) label() string {
+	if i.mode == "arg" {
+		return "argument '" + i.name + "'"
+	}
+	return "flag --" + i.name
+}
+
+//check validates the value of the item against its rules. only
+//provided values are checked, except for nonempty, which also
+//applies to defaults.
+func (i *item) check() error {
+	r := &i.rules
+	unset := i.ptr.IsValid() && i.ptr.IsNil()
+	size := 0
+	if !unset && (i.slice || i.mapping || i.val.Kind() == reflect.String) {
+		size = i.val.Len()
+		if i.val.Kind() == reflect.String {
+			size = utf8.RuneCountInString(i.val.String())
+		}
+	}
+	if r.nonempty && size == 0 {
+		return fmt.Errorf("%s must not be empty (nonempty)", i.label())
+	}
+	if unset || i.source == SourceDefault {
+		return nil
+	}
+	if i.slice && i.mode == "flag" {
+		if i.min > 0 && i.sets < i.min {
+			return fmt.Errorf("%s must have at least %s (min)", i.label(), values(i.min))
+		}
+		if i.max > 0 && i.sets > i.max {
+			return fmt.Errorf("%s must have at most %s (max)", i.label(), values(i.max))
+		}
+	}
+	if r.min != nil && i.number() < *r.min {
+		return fmt.Errorf("%s must be at least %s (min)", i.label(), r.minStr)
+	}
+	if r.max != nil && i.number() > *r.max {
+		return fmt.Errorf("%s must be at most %s (max)", i.label(), r.maxStr)
+	}
+	if r.pattern != nil {
+		vals := []string{}
+		if i.slice {
+			for j := 0; j < i.val.Len(); j++ {
+				vals = append(vals, i.val.Index(j).String())
+			}
+		} else {
+			vals = append(vals, i.val.String())
+		}
+		for _, v := range vals {
+			if !r.pattern.MatchString(v) {
+				return fmt.Errorf("%s must match %s (pattern)", i.label(), r.pattern)
+			}
+		}
+	}
+	if r.len && (size < r.minLen || r.maxLen >= 0 && size > r.maxLen) {
+		return fmt.Errorf("%s must have a length of %s (len)", i.label(), r.lenString())
+	}
+	return nil
+}
+
+func values(n int) string {
+	if n == 1 {
+		return "1 value"
+	}
+	return strconv.Itoa(n) + " values"
+}
+
+func (r *rules) lenString() string {
+	switch {
+	case r.minLen == r.maxLen:
+		return strconv.Itoa(r.minLen)
+	case r.maxLen < 0:
+		return "at least " + strconv.Itoa(r.minLen)
+	case r.minLen == 0:
+		return "at most " + strconv.Itoa(r.maxLen)
+	}
+	return strconv.Itoa(r.minLen) + "-" + strconv.Itoa(r.maxLen)
+}
+
+//rulesHelp describes the rules for the help text
+func (i *item) rulesHelp() string {
+	r := &i.rules
+	h := []string{}
+	if r.min != nil {
+		h = append(h, "min "+r.minStr)
+	}
+	if r.max != nil {
+		h = append(h, "max "+r.maxStr)
+	}
+	if i.slice && i.mode == "flag" && i.min > 0 {
+		h = append(h, "at least "+values(i.min))
+	}
+	if i.slice && i.mode == "flag" && i.max > 0 {
+		h = append(h, "at most "+values(i.max))
+	}
+	if r.pattern != nil {
+		h = append(h, "pattern "+r.pattern.String())
+	}
+	if r.len {
+		h = append(h, "length "+r.lenString())
+	}
+	if r.nonempty {
+		h = append(h, "non-empty")
+	}
+	return strings.Join(h, ", ")
+}
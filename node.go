@@ -3,6 +3,7 @@ package opts
 import (
 	"flag"
 	"reflect"
+	"sync"
 )
 
 // node is the main class, it contains
@@ -18,7 +19,29 @@ type node struct {
 	flagSkipShort map[string]bool
 	args          []*item
 	envNames      map[string]bool
+	flagSets      []*flagSet
+	structs       []reflect.Value //checked for a Validator
+	envPrefixStr  string
+	dotenvPaths   []string
+	dotenvVars    map[string]string
 	userCfgPath   bool
+	precedence    []Source
+	//config file formats
+	configFormat   string
+	configDecoders map[string]ConfigDecoder
+	configStrict   bool
+	configPaths    []string
+	configLoaded   []string
+	xdgConfig      bool
+	userDumpConfig bool
+	//config file section, provided by the parent command
+	configSection map[string]interface{}
+	configPrefix  string
+	//config reloading, see Watch
+	mu          sync.RWMutex
+	configStat  string
+	reloadItems map[*item]bool
+	watchError  func(err error)
 	//external flagsets
 	flagsets []*flag.FlagSet
 	//subcommands
@@ -38,11 +61,13 @@ type node struct {
 	padWidth                       int
 	//pretend these are in the user struct :)
 	internalOpts struct {
-		Help       bool
-		Version    bool
-		Install    bool
-		Uninstall  bool
-		ConfigPath string
+		Help        bool
+		Version     bool
+		Install     bool
+		Uninstall   bool
+		ConfigPath  string
+		ConfigDebug bool
+		DumpConfig  bool
 	}
 	complete bool
 }
@@ -76,3 +101,14 @@ func newNode(val reflect.Value) *node {
 	n.item.val = val
 	return n
 }
+
+//flagSet is a set of mutually exclusive flags
+type flagSet struct {
+	name  string
+	exact bool //exactly one flag is required (oneof)
+	items []*item
+}
+
+func (s *flagSet) flagNames() string {
+	return flagList(s.items)
+}
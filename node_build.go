@@ -3,11 +3,12 @@ package opts
 import (
 	"flag"
 	"fmt"
+	"strings"
 )
 
 //errorf to be stored until parse-time
 func (n *node) errorf(format string, args ...interface{}) error {
-	err := authorError(fmt.Sprintf(format, args...))
+	err := &AuthorError{Opts: n, Msg: fmt.Sprintf(format, args...)}
 	//only store the first error
 	if n.err == nil {
 		n.err = err
@@ -75,16 +76,83 @@ func (n *node) ConfigPath(path string) Opts {
 	return n
 }
 
+func (n *node) ConfigPaths(paths ...string) Opts {
+	n.configPaths = append(n.configPaths, paths...)
+	return n
+}
+
+func (n *node) XDGConfig() Opts {
+	n.xdgConfig = true
+	return n
+}
+
+func (n *node) ConfigFormat(format string) Opts {
+	n.configFormat = strings.ToLower(format)
+	return n
+}
+
+func (n *node) ConfigDecoder(format string, d ConfigDecoder) Opts {
+	if n.configDecoders == nil {
+		n.configDecoders = map[string]ConfigDecoder{}
+	}
+	n.configDecoders[strings.ToLower(format)] = d
+	return n
+}
+
+func (n *node) ConfigStrict() Opts {
+	n.configStrict = true
+	return n
+}
+
 func (n *node) UserConfigPath() Opts {
 	n.userCfgPath = true
 	return n
 }
 
+func (n *node) UserDumpConfig() Opts {
+	n.userDumpConfig = true
+	return n
+}
+
+func (n *node) WatchError(fn func(err error)) Opts {
+	n.watchError = fn
+	return n
+}
+
+func (n *node) Precedence(sources ...Source) Opts {
+	seen := map[Source]bool{}
+	for _, s := range sources {
+		switch s {
+		case SourceConfig, SourceEnv, SourceFlag:
+		default:
+			n.errorf("precedence cannot include source: %s", s)
+			return n
+		}
+		seen[s] = true
+	}
+	if len(sources) != len(defaultPrecedence) || len(seen) != len(defaultPrecedence) {
+		n.errorf("precedence must list each of: config, env, flag")
+		return n
+	}
+	n.precedence = sources
+	return n
+}
+
 func (n *node) UseEnv() Opts {
 	n.useEnv = true
 	return n
 }
 
+func (n *node) DotEnv(paths ...string) Opts {
+	n.dotenvPaths = append(n.dotenvPaths, paths...)
+	return n
+}
+
+func (n *node) EnvPrefix(prefix string) Opts {
+	n.envPrefixStr = strings.TrimRight(prefix, "_")
+	return n
+}
+
 //DocBefore inserts a text block before the specified template
 func (n *node) DocBefore(target, newID, template string) Opts {
 	return n.docOffset(0, target, newID, template)
@@ -180,20 +248,3 @@ func (n *node) flags() []*item {
 	return flags
 }
 
-type authorError string
-
-func (e authorError) Error() string {
-	return string(e)
-}
-
-type exitError string
-
-func (e exitError) Error() string {
-	return string(e)
-}
-
-type exitOkError string
-
-func (e exitOkError) Error() string {
-	return string(e)
-}
@@ -52,7 +52,7 @@ func (n *node) manageCompletion(uninstall bool) error {
 	} else {
 		msg = "Installed\n"
 	}
-	return exitError(msg) //always exit
+	return &exitError{err: ErrCompletion, msg: msg} //always exit
 }
 
 func (n *node) doCompletion() bool {
@@ -70,33 +70,19 @@ func (n *node) nodeCompletion() complete.Command {
 	//prepare flags
 	for _, item := range n.flags() {
 		//item's predictor
-		var p complete.Predictor
-		//choose a predictor
-		if item.noarg {
-			//disable
-			p = complete.PredictNothing
-		} else if item.completer != nil {
-			//user completer
-			p = &completerWrapper{
-				compl: item.completer,
-			}
-		} else {
-			//by default, predicts files and directories
-			p = &completerWrapper{
-				compl: &completerFS{},
-			}
-		}
+		p := item.predictor()
 		//add to completion flags set
 		c.Flags["--"+item.name] = p
 		if item.shortName != "" {
 			c.Flags["-"+item.shortName] = p
 		}
+		if item.negatable {
+			c.Flags["--no-"+item.name] = complete.PredictNothing
+		}
 	}
 	//prepare args
 	if len(n.args) > 0 {
-		c.Args = &completerWrapper{
-			compl: &completerFS{},
-		}
+		c.Args = &argsPredictor{args: n.args, flags: n.flags()}
 	}
 	//prepare sub-commands
 	for name, subn := range n.cmds {
@@ -105,6 +91,70 @@ func (n *node) nodeCompletion() complete.Command {
 	return c
 }
 
+func (i *item) predictor() complete.Predictor {
+	if i.noarg {
+		//disable
+		return complete.PredictNothing
+	} else if i.completer != nil {
+		//user completer
+		return &completerWrapper{
+			compl: i.completer,
+		}
+	} else if len(i.choices) > 0 {
+		//fixed set of values
+		return &completerWrapper{
+			compl: completerChoices(i.choices),
+		}
+	}
+	//by default, predicts files and directories
+	return &completerWrapper{
+		compl: &completerFS{},
+	}
+}
+
+//argsPredictor picks the predictor of the arg
+//at the current position
+type argsPredictor struct {
+	args  []*item
+	flags []*item
+}
+
+func (a *argsPredictor) Predict(args complete.Args) []string {
+	pos := 0
+	value := false
+	for _, c := range args.Completed {
+		//skip the value of the previous flag
+		if value {
+			value = false
+			continue
+		}
+		if strings.HasPrefix(c, "-") {
+			value = a.takesValue(c)
+			continue
+		}
+		pos++
+	}
+	if pos >= len(a.args) {
+		pos = len(a.args) - 1
+	}
+	return a.args[pos].predictor().Predict(args)
+}
+
+//takesValue returns whether the flag c is
+//followed by its value, as in --format json
+func (a *argsPredictor) takesValue(c string) bool {
+	if strings.Contains(c, "=") {
+		return false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(c, "-"), "-")
+	for _, i := range a.flags {
+		if name == i.name || name == i.shortName {
+			return !i.IsBoolFlag()
+		}
+	}
+	return false
+}
+
 type completerWrapper struct {
 	compl Completer
 }
@@ -118,6 +168,18 @@ func (w *completerWrapper) Predict(args complete.Args) []string {
 	return results
 }
 
+type completerChoices []string
+
+func (c completerChoices) Complete(user string) []string {
+	completed := []string{}
+	for _, choice := range c {
+		if strings.HasPrefix(choice, user) {
+			completed = append(completed, choice)
+		}
+	}
+	return completed
+}
+
 type completerFS struct{}
 
 func (*completerFS) Complete(user string) []string {
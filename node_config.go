@@ -0,0 +1,753 @@
+package opts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//defaultPrecedence lists the value sources
+//from lowest to highest precedence
+var defaultPrecedence = []Source{SourceConfig, SourceEnv, SourceFlag}
+
+//rank returns the precedence of the given source. struct
+//defaults are always lowest and positional arguments are
+//always highest.
+func (n *node) rank(s Source) int {
+	switch s {
+	case SourceDefault:
+		return 0
+	case SourceArg:
+		return len(n.precedence) + 1
+	}
+	for i, p := range n.precedence {
+		if p == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+//apply sets the item using the given source, replacing values
+//from lower precedence sources. maps are merged instead, where
+//entries from the higher precedence source win.
+func (n *node) apply(item *item, src Source, set func() error) error {
+	//only reapply the given items when reloading config
+	if n.reloadItems != nil && !n.reloadItems[item] {
+		return nil
+	}
+	higher := n.rank(src) > n.rank(item.source)
+	if item.mapping && item.set() {
+		if err := n.mergeMap(item, src, set); err != nil {
+			return err
+		}
+		if higher {
+			item.source = src
+		}
+		return nil
+	} else if !higher {
+		return nil
+	}
+	if item.set() {
+		item.reset()
+	}
+	if err := set(); err != nil {
+		return err
+	}
+	item.setSource(src)
+	return nil
+}
+
+//mergeMap applies set to an empty map, and then merges the
+//previous entries back in, unless they have lower precedence
+func (n *node) mergeMap(item *item, src Source, set func() error) error {
+	prev := reflect.ValueOf(item.val.Interface())
+	prevSources := item.entrySources
+	item.val.Set(reflect.MakeMap(item.val.Type()))
+	if err := set(); err != nil {
+		return err
+	}
+	item.entrySources = map[interface{}]Source{}
+	for _, k := range item.val.MapKeys() {
+		item.entrySources[k.Interface()] = src
+	}
+	iter := prev.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		s := prevSources[k.Interface()]
+		if item.val.MapIndex(k).IsValid() && n.rank(s) < n.rank(src) {
+			continue
+		}
+		item.val.SetMapIndex(k, iter.Value())
+		item.entrySources[k.Interface()] = s
+	}
+	return nil
+}
+
+//applyEnv sets flags from their environment variables,
+//replacing values from lower precedence sources
+func (n *node) applyEnv() error {
+	for _, item := range append(n.flags(), n.args...) {
+		k := item.envName
+		if k == "" {
+			continue
+		}
+		v := n.getenv(k)
+		if v == "" {
+			continue
+		}
+		//maps and arg lists are a comma separated list
+		//of entries, unless they already have a separator
+		vs := []string{v}
+		if (item.mapping || item.slice && item.mode == "arg") && item.sep == "" {
+			vs = splitEscaped(v, ",")
+		}
+		err := n.apply(item, SourceEnv, func() error {
+			for _, v := range vs {
+				if err := item.Set(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return invalidValue(item, v, err, "%s '%s' cannot set invalid env var (%s): %s", item.mode, item.name, k, err)
+		}
+	}
+	return nil
+}
+
+//applyFiles sets each flag from its --<name>-file flag, using
+//the source of the file flag. a flag and its file flag cannot
+//both be provided by the same source.
+func (n *node) applyFiles() error {
+	for _, f := range n.flags() {
+		i := f.fileFor
+		if i == nil || f.source == SourceDefault {
+			continue
+		}
+		if i.source == f.source {
+			return constraint([]string{i.name, f.name}, "--%s and --%s cannot be used together", i.name, f.name)
+		}
+		v, err := readValueFile(f.String())
+		if err != nil {
+			return invalidValue(f, f.String(), err, "flag '%s' is invalid: %s", f.name, err)
+		}
+		err = n.apply(i, f.source, func() error {
+			return i.Set(v)
+		})
+		if err != nil {
+			return invalidValue(i, v, err, "flag '%s' is invalid: %s", i.name, err)
+		}
+	}
+	return nil
+}
+
+//applyImplies sets the flags implied by each provided flag to true,
+//using the source of the implying flag, until no more flags change
+func (n *node) applyImplies() error {
+	for changed := true; changed; {
+		changed = false
+		for _, i := range n.flags() {
+			if i.source == SourceDefault {
+				continue
+			}
+			for _, d := range i.implies {
+				if d.source != SourceDefault && n.rank(d.source) >= n.rank(i.source) {
+					continue
+				}
+				err := n.apply(d, i.source, func() error {
+					return d.Set("true")
+				})
+				if err != nil {
+					return invalidValue(d, "true", err, "flag '%s' is invalid: %s", d.name, err)
+				}
+				changed = changed || d.source == i.source
+			}
+		}
+	}
+	return nil
+}
+
+//readValueFile reads a flag value from a file, without
+//surrounding whitespace (such as a trailing newline)
+func readValueFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+//loadDotEnv reads the DotEnv files, where later files override
+//earlier files. files which do not exist are skipped.
+func (n *node) loadDotEnv() error {
+	if len(n.dotenvPaths) == 0 || n.dotenvVars != nil {
+		return nil
+	}
+	vars := map[string]string{}
+	//expand variables to their final values, so the
+	//real environment takes precedence here too
+	lookup := func(k string) string {
+		if v := os.Getenv(k); v != "" {
+			return v
+		} else if v, ok := vars[k]; ok {
+			return v
+		}
+		return n.getenv(k)
+	}
+	for _, p := range n.dotenvPaths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return configError(p, "", err, "dotenv file '%s': %s", p, err)
+		}
+		dvs, err := parseDotEnv(string(b))
+		if err != nil {
+			return configError(p, "", err, "dotenv file '%s': %s", p, err)
+		}
+		for _, dv := range dvs {
+			v := dv.value
+			if !dv.literal {
+				v = expandDotEnv(v, lookup)
+			}
+			vars[dv.key] = v
+		}
+	}
+	n.dotenvVars = vars
+	return nil
+}
+
+//getenv looks up the environment, followed by the
+//DotEnv files of this command and its parents
+func (n *node) getenv(k string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	for c := n; c != nil; c = c.parent {
+		if v, ok := c.dotenvVars[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+//envEnabled returns whether env names are derived for all
+//items, which is inherited from parent commands
+func (n *node) envEnabled() bool {
+	for c := n; c != nil; c = c.parent {
+		if c.useEnv || c.envPrefixStr != "" {
+			return true
+		}
+	}
+	return false
+}
+
+//envPrefix returns the prefix of derived env names. subcommands
+//inherit their parent's prefix, with their own name appended.
+func (n *node) envPrefix() string {
+	if n.envPrefixStr != "" {
+		return n.envPrefixStr
+	}
+	if n.parent != nil {
+		if p := n.parent.envPrefix(); p != "" {
+			return p + "_" + camel2const(n.name)
+		}
+	}
+	return ""
+}
+
+//envName derives an env name from the given name
+func (n *node) envName(name string) string {
+	e := camel2const(name)
+	if p := n.envPrefix(); p != "" {
+		e = p + "_" + e
+	}
+	return e
+}
+
+//applyConfig sets flags and args from the config files (or
+//the section of the parent's config files for this command),
+//replacing values from lower precedence sources. keys which
+//only match a json field name are unmarshalled directly into
+//the struct.
+func (n *node) applyConfig() error {
+	m := n.configSection
+	//subcommand sections are set again below, so a
+	//section removed from the file is not reapplied
+	for _, sub := range n.cmds {
+		sub.configSection = nil
+		sub.configPrefix = ""
+	}
+	if files := n.configFiles(); len(files) > 0 {
+		n.configStat = statFiles(files)
+		fm, err := n.loadConfig(files)
+		if err != nil {
+			return err
+		}
+		if n.internalOpts.ConfigDebug {
+			if len(n.configLoaded) == 0 {
+				fmt.Fprintf(os.Stderr, "no config files found\n")
+			}
+			for _, f := range n.configLoaded {
+				fmt.Fprintf(os.Stderr, "loaded config file: %s\n", f)
+			}
+		}
+		if fm != nil {
+			m = fm
+			n.configPrefix = ""
+		}
+	}
+	if m == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	//internal flags (help, config-path, etc) are not config keys
+	items := []*item{}
+	for _, i := range append(n.flags(), n.args...) {
+		if !i.internal {
+			items = append(items, i)
+		}
+	}
+	fields := jsonFields(n.val)
+	rest := map[string]interface{}{}
+	for _, k := range keys {
+		v := m[k]
+		key := n.configPrefix + k
+		//flags and args, by name or by json field name
+		item := matchConfigKey(items, k)
+		f, isField := matchJSONField(fields, k)
+		if item == nil && isField {
+			item = fieldItem(items, f)
+		}
+		if item != nil {
+			if v == nil {
+				continue
+			}
+			err := n.apply(item, SourceConfig, func() error {
+				return item.setConfig(v)
+			})
+			if err != nil {
+				return invalidValue(item, fmt.Sprintf("%v", v), err, "config '%s' is invalid: %s", key, err)
+			}
+			continue
+		}
+		//subcommand sections, applied if the subcommand is used
+		if sub, ok := n.cmds[k]; ok {
+			if v == nil {
+				continue
+			}
+			section, ok := v.(map[string]interface{})
+			if !ok {
+				return configError("", key, nil, "config '%s' must be an object", key)
+			}
+			sub.configSection = section
+			sub.configPrefix = key + "."
+			continue
+		}
+		//other fields (opts:"-", nested structs)
+		if isField {
+			rest[k] = v
+			continue
+		}
+		if n.strictConfig() {
+			return configError("", key, nil, "config '%s' is unknown", key)
+		}
+		fmt.Fprintf(os.Stderr, "warning: config '%s' is unknown\n", key)
+	}
+	if len(rest) > 0 {
+		b, err := json.Marshal(rest)
+		if err == nil {
+			err = json.Unmarshal(b, n.val.Addr().Interface())
+		}
+		if err != nil {
+			return configError("", "", err, "invalid config file: %s", err)
+		}
+	}
+	return nil
+}
+
+//jsonField is a struct field as decoded by encoding/json
+type jsonField struct {
+	name string
+	val  reflect.Value
+}
+
+//jsonFields returns the fields of the struct sv which
+//encoding/json would decode, including embedded fields
+func jsonFields(sv reflect.Value) []jsonField {
+	fields := []jsonField{}
+	for i := 0; i < sv.NumField(); i++ {
+		sf := sv.Type().Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" && sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(sv.Field(i))...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue //unexported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, jsonField{name: name, val: sv.Field(i)})
+	}
+	return fields
+}
+
+//matchJSONField finds the field for the given config key,
+//preferring an exact match, like encoding/json
+func matchJSONField(fields []jsonField, key string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+//fieldItem returns the item of the given field, if any
+func fieldItem(items []*item, f jsonField) *item {
+	for _, i := range items {
+		v := i.field
+		if v.IsValid() && v.Type() == f.val.Type() && v.UnsafeAddr() == f.val.UnsafeAddr() {
+			return i
+		}
+	}
+	return nil
+}
+
+//configFiles returns all config file paths, from lowest to
+//highest precedence. XDG search paths come first, followed by
+//ConfigPaths, and finally ConfigPath (or --config-path).
+func (n *node) configFiles() []string {
+	files := []string{}
+	if n.xdgConfig {
+		dirs := []string{filepath.Join("/etc", n.name)}
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			if home := os.Getenv("HOME"); home != "" {
+				xdg = filepath.Join(home, ".config")
+			}
+		}
+		if xdg != "" {
+			dirs = append(dirs, filepath.Join(xdg, n.name))
+		}
+		exts := n.configExts()
+		for _, d := range dirs {
+			for _, ext := range exts {
+				files = append(files, filepath.Join(d, "config."+ext))
+			}
+		}
+		//working directory
+		for _, ext := range exts {
+			files = append(files, n.name+"."+ext)
+		}
+	}
+	files = append(files, n.configPaths...)
+	if c := n.internalOpts.ConfigPath; c != "" {
+		files = append(files, c)
+	}
+	return files
+}
+
+//configExts returns the file extensions of all known config formats
+func (n *node) configExts() []string {
+	exts := []string{}
+	seen := map[string]bool{}
+	add := func(decoders map[string]ConfigDecoder) {
+		for ext := range decoders {
+			if !seen[ext] {
+				seen[ext] = true
+				exts = append(exts, ext)
+			}
+		}
+	}
+	for c := n; c != nil; c = c.parent {
+		add(c.configDecoders)
+	}
+	add(builtinConfigDecoders)
+	sort.Strings(exts)
+	return exts
+}
+
+//foundConfigFiles returns the config files which exist
+func (n *node) foundConfigFiles() []string {
+	found := []string{}
+	for _, f := range n.configFiles() {
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+//loadConfig reads, decodes and deep-merges the given config files,
+//where later files override earlier files. missing files are skipped,
+//unless the file was provided by the user with --config-path.
+func (n *node) loadConfig(files []string) (map[string]interface{}, error) {
+	var merged map[string]interface{}
+	n.configLoaded = nil
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			if n.userConfigFile(f) {
+				return nil, configError(f, "", err, "config file not found: %s", f)
+			}
+			continue
+		} else if err != nil {
+			return nil, configError(f, "", err, "config file '%s': %s", f, err)
+		}
+		format := n.findConfigFormat(f)
+		d := n.findConfigDecoder(format)
+		if d == nil {
+			msg := fmt.Sprintf("no decoder registered for format '%s' (see ConfigDecoder)", format)
+			if n.userConfigFile(f) {
+				return nil, configError(f, "", nil, "%s", msg)
+			}
+			return nil, n.errorf("%s", msg)
+		}
+		m, err := d.Decode(b)
+		if err != nil {
+			return nil, configError(f, "", err, "invalid config file: %s: %s", f, err)
+		}
+		m = normalizeConfig(m).(map[string]interface{})
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+		mergeConfig(merged, m)
+		n.configLoaded = append(n.configLoaded, f)
+	}
+	return merged, nil
+}
+
+//userConfigFile returns whether the given path was
+//provided by the user with --config-path
+func (n *node) userConfigFile(path string) bool {
+	if !n.userCfgPath || path != n.internalOpts.ConfigPath {
+		return false
+	}
+	i := n.findItem("config-path")
+	return i != nil && i.source != SourceDefault
+}
+
+//mergeConfig deep-merges src into dst
+func mergeConfig(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				mergeConfig(dm, sm)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+//strictConfig is inherited from parent commands
+func (n *node) strictConfig() bool {
+	for c := n; c != nil; c = c.parent {
+		if c.configStrict {
+			return true
+		}
+	}
+	return false
+}
+
+//findConfigFormat returns the explicit config format,
+//otherwise the file extension of the given path
+func (n *node) findConfigFormat(path string) string {
+	for c := n; c != nil; c = c.parent {
+		if c.configFormat != "" {
+			return c.configFormat
+		}
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext != "" && n.findConfigDecoder(ext) != nil {
+		return ext
+	}
+	//well-known formats require a decoder
+	if f, ok := configFormatExts[ext]; ok {
+		return f
+	}
+	//unknown extensions are assumed to be JSON
+	return "json"
+}
+
+//configFormatExts are the extensions of well-known config
+//formats, which are not built-in, see ConfigDecoder
+var configFormatExts = map[string]string{
+	"yaml": "yaml",
+	"yml":  "yaml",
+	"toml": "toml",
+	"hcl":  "hcl",
+	"ini":  "ini",
+}
+
+//findConfigDecoder searches this command and its
+//parents, followed by the built-in decoders
+func (n *node) findConfigDecoder(format string) ConfigDecoder {
+	for c := n; c != nil; c = c.parent {
+		if d, ok := c.configDecoders[format]; ok {
+			return d
+		}
+	}
+	return builtinConfigDecoders[format]
+}
+
+//matchConfigKey finds the item for the given config key.
+//keys are expected to be flag names, however, case, dashes
+//and underscores are ignored, so the struct field names
+//(as used by encoding/json) and env-style names also match.
+func matchConfigKey(items []*item, key string) *item {
+	for _, i := range items {
+		if i.name == key {
+			return i
+		}
+	}
+	k := normalizeKey(key)
+	for _, i := range items {
+		if normalizeKey(i.name) == k || normalizeKey(i.fieldName) == k {
+			return i
+		}
+	}
+	return nil
+}
+
+func normalizeKey(s string) string {
+	s = strings.Replace(s, "-", "", -1)
+	s = strings.Replace(s, "_", "", -1)
+	return strings.ToLower(s)
+}
+
+//normalizeConfig converts objects with non-string keys,
+//as produced by some YAML decoders, into string keyed maps
+func normalizeConfig(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalizeConfig(e)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprintf("%v", k)] = normalizeConfig(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = normalizeConfig(e)
+		}
+		return l
+	}
+	return v
+}
+
+//ConfigDecoder decodes the contents of a config file into a map of
+//keys to values. Keys should be flag names. Values may be strings,
+//numbers, bools, lists ([]interface{}) or objects (map[string]interface{}).
+type ConfigDecoder interface {
+	Decode(b []byte) (map[string]interface{}, error)
+}
+
+//ConfigDecoderFunc allows a function to be used as a ConfigDecoder
+type ConfigDecoderFunc func(b []byte) (map[string]interface{}, error)
+
+//Decode calls f(b)
+func (f ConfigDecoderFunc) Decode(b []byte) (map[string]interface{}, error) {
+	return f(b)
+}
+
+//ConfigEncoder may be implemented by a ConfigDecoder,
+//allowing DumpConfig to output its format
+type ConfigEncoder interface {
+	Encode(m map[string]interface{}) ([]byte, error)
+}
+
+//builtinConfigDecoders can be overridden with ConfigDecoder
+var builtinConfigDecoders = map[string]ConfigDecoder{
+	"json":   ConfigDecoderFunc(decodeJSON),
+	"env":    ConfigDecoderFunc(decodeDotEnv),
+	"dotenv": ConfigDecoderFunc(decodeDotEnv),
+}
+
+func decodeJSON(b []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(stripJSONComments(b)))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//stripJSONComments removes "//" line comments, which
+//are not valid JSON, though they are output by DumpConfig
+func stripJSONComments(b []byte) []byte {
+	if !bytes.Contains(b, []byte("//")) {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	str := false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if str {
+			if c == '\\' && i+1 < len(b) {
+				out = append(out, c, b[i+1])
+				i++
+				continue
+			}
+			if c == '"' {
+				str = false
+			}
+		} else if c == '"' {
+			str = true
+		} else if c == '/' && i+1 < len(b) && b[i+1] == '/' {
+			//skip to the end of the line
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			if i < len(b) {
+				out = append(out, '\n')
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func decodeDotEnv(b []byte) (map[string]interface{}, error) {
+	vars, err := parseDotEnv(string(b))
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	for _, v := range vars {
+		m[v.key] = v.value
+	}
+	return m, nil
+}
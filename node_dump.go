@@ -0,0 +1,263 @@
+package opts
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//dumpEntry is a single key in a dumped config file,
+//either an item value or a subcommand section
+type dumpEntry struct {
+	key     string
+	help    string
+	item    *item
+	value   interface{}
+	section []*dumpEntry
+}
+
+//dumping reports whether --dump-config was
+//given to this command or any of its parents
+func (n *node) dumping() bool {
+	for c := n; c != nil; c = c.parent {
+		if c.internalOpts.DumpConfig {
+			return true
+		}
+	}
+	return false
+}
+
+//dumpConfig prints the config of the root command,
+//which includes each selected subcommand
+func (n *node) dumpConfig() error {
+	s, err := n.root().DumpConfig()
+	if err != nil {
+		return err
+	}
+	return &exitOkError{err: ErrDumpConfig, msg: s}
+}
+
+//DumpConfig returns the resolved config of this
+//command and its selected subcommands
+func (n *node) DumpConfig() (string, error) {
+	path := n.internalOpts.ConfigPath
+	if path == "" && len(n.configPaths) > 0 {
+		path = n.configPaths[len(n.configPaths)-1]
+	}
+	format := n.findConfigFormat(path)
+	entries := n.dumpEntries()
+	switch format {
+	case "json":
+		b := &bytes.Buffer{}
+		if err := dumpJSON(b, entries, ""); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	case "env", "dotenv":
+		return dumpDotEnv(entries), nil
+	}
+	e, ok := n.findConfigDecoder(format).(ConfigEncoder)
+	if !ok {
+		return "", fmt.Errorf("config format '%s' has no encoder", format)
+	}
+	b, err := e.Encode(dumpMap(entries))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (n *node) dumpEntries() []*dumpEntry {
+	entries := []*dumpEntry{}
+	for _, i := range n.flags() {
+		if i.internal || i.fileFor != nil {
+			continue
+		}
+		entries = append(entries, &dumpEntry{
+			key:   i.name,
+			help:  i.help,
+			item:  i,
+			value: i.configValue(),
+		})
+	}
+	if n.cmd != nil {
+		help := n.cmd.help
+		if help == "" {
+			help = n.cmd.summary
+		}
+		entries = append(entries, &dumpEntry{
+			key:     n.cmd.name,
+			help:    help,
+			section: n.cmd.dumpEntries(),
+		})
+	}
+	return entries
+}
+
+//configValue returns the current value of the item
+//in the same form as a decoded config file
+func (i *item) configValue() interface{} {
+	if i.ptr.IsValid() && i.ptr.IsNil() {
+		return nil
+	}
+	v := i.val
+	if i.slice {
+		l := []interface{}{}
+		for j := 0; j < v.Len(); j++ {
+			l = append(l, configScalar(v.Index(j)))
+		}
+		return l
+	}
+	if i.mapping {
+		m := map[string]interface{}{}
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprintf("%v", configScalar(k))] = configScalar(v.MapIndex(k))
+		}
+		return m
+	}
+	return configScalar(v)
+}
+
+//configScalar prefers the text form of values with
+//String or MarshalText methods (e.g. time.Duration)
+func configScalar(v reflect.Value) interface{} {
+	vals := []reflect.Value{v}
+	if v.CanAddr() {
+		vals = append(vals, v.Addr())
+	}
+	for _, v := range vals {
+		if !v.CanInterface() {
+			continue
+		}
+		if t, ok := v.Interface().(encoding.TextMarshaler); ok {
+			if b, err := t.MarshalText(); err == nil {
+				return string(b)
+			}
+		}
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+//dumpJSON writes entries as a JSON object, with
+//help text as line comments (see stripJSONComments)
+func dumpJSON(b *bytes.Buffer, entries []*dumpEntry, indent string) error {
+	b.WriteString("{\n")
+	for j, e := range entries {
+		in := indent + "  "
+		if e.help != "" {
+			for _, l := range strings.Split(e.help, "\n") {
+				b.WriteString(in + "// " + l + "\n")
+			}
+		}
+		k, _ := json.Marshal(e.key)
+		b.WriteString(in + string(k) + ": ")
+		if e.section != nil {
+			if err := dumpJSON(b, e.section, in); err != nil {
+				return err
+			}
+		} else {
+			v, err := json.Marshal(e.value)
+			if err != nil {
+				return fmt.Errorf("config '%s': %s", e.key, err)
+			}
+			b.Write(v)
+		}
+		if j < len(entries)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + "}")
+	if indent == "" {
+		b.WriteString("\n")
+	}
+	return nil
+}
+
+//dumpDotEnv writes entries as a dotenv file. subcommand
+//sections cannot be represented, so they are omitted.
+func dumpDotEnv(entries []*dumpEntry) string {
+	b := strings.Builder{}
+	for _, e := range entries {
+		if e.section != nil {
+			continue
+		}
+		if e.help != "" {
+			for _, l := range strings.Split(e.help, "\n") {
+				b.WriteString("# " + l + "\n")
+			}
+		}
+		k := strings.ToUpper(strings.Replace(e.key, "-", "_", -1))
+		if e.value == nil {
+			b.WriteString("# " + k + "=\n")
+			continue
+		}
+		b.WriteString(k + "=" + quoteDotEnv(dotEnvString(e.item, e.value)) + "\n")
+	}
+	return b.String()
+}
+
+func dotEnvString(i *item, v interface{}) string {
+	sep := i.sep
+	if sep == "" {
+		sep = ","
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		s := make([]string, len(v))
+		for j, e := range v {
+			s[j] = fmt.Sprintf("%v", e)
+		}
+		return strings.Join(s, sep)
+	case map[string]interface{}:
+		s := []string{}
+		for k, e := range v {
+			s = append(s, fmt.Sprintf("%s%s%v", k, i.kvSep(), e))
+		}
+		sort.Strings(s)
+		return strings.Join(s, sep)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+//quoteDotEnv double-quotes values which would
+//otherwise be altered by parseDotEnv
+func quoteDotEnv(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n#\"'\\") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+//dumpMap converts entries into a map for ConfigEncoders
+func dumpMap(entries []*dumpEntry) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, e := range entries {
+		if e.section != nil {
+			m[e.key] = dumpMap(e.section)
+		} else {
+			m[e.key] = e.value
+		}
+	}
+	return m
+}
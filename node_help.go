@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -22,6 +21,8 @@ type data struct {
 	Version      string
 	Summary      string
 	Repo, Author string
+	Constraints  []string
+	ConfigFiles  []string
 	ErrMsg       string
 }
 
@@ -41,6 +42,8 @@ var DefaultOrder = []string{
 	"summary",
 	"args",
 	"flaggroups",
+	"constraints",
+	"configfiles",
 	"cmds",
 	"author",
 	"version",
@@ -68,9 +71,16 @@ var DefaultTemplates = map[string]string{
 	"usage":         `Usage: {{.Name }} [options]{{template "usageargs" .}}{{template "usagecmd" .}}` + "\n",
 	"usageargs":     `{{range .Args}} {{.Name}}{{end}}`,
 	"usagecmd":      `{{if .CmdGroups}} <command>{{end}}`,
+	"extrarequired": `{{if .}}required{{end}}`,
+	"extrachoices":  `{{if .}}one of {{.}}{{end}}`,
+	"extrakeyvalue": `{{if .}}{{.}}{{end}}`,
+	"extrarules":    `{{if .}}{{.}}{{end}}`,
+	"extrarequires": `{{if .}}requires {{.}}{{end}}`,
+	"extraimplies":  `{{if .}}implies {{.}}{{end}}`,
 	"extradefault":  `{{if .}}default {{.}}{{end}}`,
 	"extraenv":      `{{if .}}env {{.}}{{end}}`,
 	"extramultiple": `{{if .}}allows multiple{{end}}`,
+	"extrafile":     `{{if .}}or @path to read from a file{{end}}`,
 	"summary":       "{{if .Summary}}\n{{ .Summary }}\n{{end}}",
 	"args":          `{{range .Args}}{{template "arg" .}}{{end}}`,
 	"arg":           "{{if .Help}}\n{{.Help}}\n{{end}}",
@@ -78,6 +88,8 @@ var DefaultTemplates = map[string]string{
 	"flaggroup": "{{if .Flags}}\n{{if .Name}}{{.Name}} options{{else}}Options{{end}}:\n" +
 		`{{ range $f := .Flags}}{{template "flag" $f}}{{end}}{{end}}`,
 	"flag":    `{{.Name}}{{if .Help}}{{.Pad}}{{.Help}}{{end}}` + "\n",
+	"constraints": "{{if .Constraints}}\nConstraints:\n{{range .Constraints}}{{.}}\n{{end}}{{end}}",
+	"configfiles": "{{if .ConfigFiles}}\nConfig files:\n{{range .ConfigFiles}}{{$.Pad}}{{.}}\n{{end}}{{end}}",
 	"cmds":     `{{ range $g := .CmdGroups}}{{template "cmdgroup" $g}}{{end}}`,
 	"cmdgroup": "{{if .Flags}}\n{{if .Name}}{{.Name}} commands{{else}}Commands{{end}}:\n" +
 		`{{ range $sub := .Flags}}{{template "cmd" $sub}}{{end}}{{end}}`,
@@ -191,7 +203,6 @@ func convert(o *node) (*data, error) {
 		}
 		args[i] = &datum{
 			Name: n,
-			Help: constrain(arg.help, o.lineWidth),
 		}
 	}
 	flagGroups := make([]*datumGroup, len(o.flagGroups))
@@ -207,6 +218,9 @@ func convert(o *node) (*data, error) {
 		for i, item := range g.flags {
 			to := &datum{Pad: pad}
 			to.Name = "--" + item.name
+			if item.negatable {
+				to.Name = "--[no-]" + item.name
+			}
 			if item.shortName != "" && !o.flagSkipShort[item.name] {
 				to.Name += ", -" + item.shortName
 			}
@@ -220,8 +234,8 @@ func convert(o *node) (*data, error) {
 	}
 	//get item help, with optional default values and env names and
 	//constrain to a specific line width
-	extras := make([]*template.Template, 3)
-	keys := []string{"default", "env", "multiple"}
+	keys := []string{"required", "choices", "rules", "keyvalue", "requires", "implies", "default", "env", "multiple", "file"}
+	extras := make([]*template.Template, len(keys))
 	for i, k := range keys {
 		t, err := template.New("").Parse(o.templates["extra"+k])
 		if err != nil {
@@ -229,6 +243,25 @@ func convert(o *node) (*data, error) {
 		}
 		extras[i] = t
 	}
+	//args only display their choices, rules and env
+	for i, arg := range o.args {
+		vals := []interface{}{strings.Join(arg.choices, "|"), arg.rulesHelp(), arg.envName}
+		outs := []string{}
+		for j, k := range []string{"choices", "rules", "env"} {
+			t, err := template.New("").Parse(o.templates["extra"+k])
+			if err != nil {
+				return nil, fmt.Errorf("template extra%s: %s", k, err)
+			}
+			b := strings.Builder{}
+			if err := t.Execute(&b, vals[j]); err != nil {
+				return nil, err
+			}
+			if b.Len() > 0 {
+				outs = append(outs, b.String())
+			}
+		}
+		args[i].Help = constrain(appendExtra(arg.help, strings.Join(outs, ", ")), o.lineWidth)
+	}
 	//calculate...
 	padsInOption := o.padWidth
 	optionNameWidth := max + padsInOption
@@ -242,7 +275,11 @@ func convert(o *node) (*data, error) {
 			//constrain help text
 			item := o.flagGroups[i].flags[j]
 			//render flag help string
-			vals := []interface{}{item.defstr, item.envName, item.slice}
+			keyvalue := ""
+			if item.mapping {
+				keyvalue = "key" + item.kvSep() + "value"
+			}
+			vals := []interface{}{item.required, strings.Join(item.choices, "|"), item.rulesHelp(), keyvalue, flagList(item.requires), flagList(item.implies), item.defstr, item.envName, item.slice || item.mapping || item.counter, item.fileRef}
 			outs := []string{}
 			for i, v := range vals {
 				b := strings.Builder{}
@@ -253,18 +290,7 @@ func convert(o *node) (*data, error) {
 					outs = append(outs, b.String())
 				}
 			}
-			help := item.help
-			extra := strings.Join(outs, ", ")
-			if extra != "" {
-				if help == "" {
-					help = extra
-				} else if trailingBrackets.MatchString(help) {
-					m := trailingBrackets.FindStringSubmatch(help)
-					help = m[1] + "(" + m[2] + ", " + extra + ")"
-				} else {
-					help += " (" + extra + ")"
-				}
-			}
+			help := appendExtra(item.help, strings.Join(outs, ", "))
 			help = constrain(help, helpWidth)
 			//align each row after the flag
 			lines := strings.Split(help, "\n")
@@ -302,7 +328,7 @@ func convert(o *node) (*data, error) {
 				h = s.summary
 			}
 			explicitMatch := o.cmdname != nil && *o.cmdname == s.name
-			envMatch := o.cmdnameEnv != "" && os.Getenv(o.cmdnameEnv) == s.name
+			envMatch := o.cmdnameEnv != "" && o.getenv(o.cmdnameEnv) == s.name
 			if explicitMatch || envMatch {
 				if h == "" {
 					h = "default"
@@ -319,10 +345,19 @@ func convert(o *node) (*data, error) {
 		}
 		cmdGroups[gi] = dg
 	}
+	//describe flag constraints
+	constraints := []string{}
+	for _, s := range o.flagSets {
+		if s.exact {
+			constraints = append(constraints, "exactly one of "+s.flagNames())
+		} else {
+			constraints = append(constraints, "at most one of "+s.flagNames())
+		}
+	}
 	//convert error to string
-	err := ""
+	errmsg := ""
 	if o.err != nil {
-		err = o.err.Error()
+		errmsg = o.err.Error()
 	}
 	return &data{
 		datum: datum{
@@ -330,14 +365,41 @@ func convert(o *node) (*data, error) {
 			Help: o.help,
 			Pad:  pad,
 		},
-		Args:       args,
-		FlagGroups: flagGroups,
-		CmdGroups:  cmdGroups,
-		Order:      o.order,
-		Version:    o.version,
-		Summary:    constrain(o.summary, o.lineWidth),
-		Repo:       o.repo,
-		Author:     o.author,
-		ErrMsg:     err,
+		Args:        args,
+		FlagGroups:  flagGroups,
+		CmdGroups:   cmdGroups,
+		Order:       o.order,
+		Version:     o.version,
+		Summary:     constrain(o.summary, o.lineWidth),
+		Repo:        o.repo,
+		Author:      o.author,
+		Constraints: constraints,
+		ConfigFiles: o.foundConfigFiles(),
+		ErrMsg:      errmsg,
 	}, nil
 }
+
+//flagList formats flag names for help text
+func flagList(items []*item) string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = "--" + item.name
+	}
+	return strings.Join(names, ", ")
+}
+
+//appendExtra adds extra information to the end of
+//the help text, merging into any trailing brackets
+func appendExtra(help, extra string) string {
+	if extra == "" {
+		return help
+	}
+	if help == "" {
+		return extra
+	}
+	if trailingBrackets.MatchString(help) {
+		m := trailingBrackets.FindStringSubmatch(help)
+		return m[1] + "(" + m[2] + ", " + extra + ")"
+	}
+	return help + " (" + extra + ")"
+}
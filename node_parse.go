@@ -1,7 +1,6 @@
 package opts
 
 import (
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,6 +8,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -25,23 +25,28 @@ func (n *node) Parse() ParsedOpts {
 func (n *node) ParseArgs(args []string) ParsedOpts {
 	o, err := n.ParseArgsError(args)
 	if err != nil {
-		//expected ok exit (help, version), print message and exit 0
-		if ee, ok := err.(exitOkError); ok {
-			fmt.Fprint(os.Stderr, string(ee))
+		//expected ok exit (help, version, config), print message and exit 0
+		if he, ok := err.(*HelpError); ok {
+			fmt.Fprint(os.Stderr, he.msg)
+			os.Exit(0)
+		}
+		if ee, ok := err.(*exitOkError); ok {
+			fmt.Fprint(os.Stderr, ee.msg)
 			os.Exit(0)
 		}
 		//expected user error, print message as-is
-		if ee, ok := err.(exitError); ok {
-			fmt.Fprint(os.Stderr, string(ee))
+		if ee, ok := err.(*exitError); ok {
+			fmt.Fprint(os.Stderr, ee.msg)
 			os.Exit(1)
 		}
 		//expected opts error, print message to programmer
-		if ae, ok := err.(authorError); ok {
+		if ae, ok := err.(*AuthorError); ok {
 			fmt.Fprintf(os.Stderr, "opts usage error: %s\n", ae)
 			os.Exit(1)
 		}
-		//unexpected exit (1) embed message in help to user
-		fmt.Fprint(os.Stderr, n.Help())
+		//unexpected exit (1) embed message in the
+		//help of the command which failed
+		fmt.Fprint(os.Stderr, errorNode(err, n).Help())
 		os.Exit(1)
 	}
 	//success
@@ -60,12 +65,19 @@ func (n *node) ParseArgsError(args []string) (ParsedOpts, error) {
 		os.Exit(0)
 	}
 	//parse, storing any errors on the node itself
-	if err := n.parse(args); err != nil {
-		_, eoe := err.(exitOkError)
-		_, ee := err.(exitError)
-		_, ae := err.(authorError)
-		if !eoe && !ee && !ae {
+	err := n.parse(args)
+	//user validation once all commands are parsed
+	if err == nil {
+		err = n.runValidators()
+	}
+	if err != nil {
+		_, he := err.(*HelpError)
+		_, eoe := err.(*exitOkError)
+		_, ee := err.(*exitError)
+		_, ae := err.(*AuthorError)
+		if !he && !eoe && !ee && !ae {
 			n.err = err
+			errorNode(err, n).err = err
 		}
 		return n, err
 	}
@@ -75,7 +87,14 @@ func (n *node) ParseArgsError(args []string) (ParsedOpts, error) {
 
 // parse validates and initialises all internal items
 // and then passes the args through, setting them items required
-func (n *node) parse(args []string) error {
+func (n *node) parse(args []string) (err error) {
+	//errors from this command carry this command,
+	//errors from subcommands already carry theirs
+	defer func() {
+		if oe, ok := err.(optsError); ok {
+			oe.setOpts(n)
+		}
+	}()
 	//return the stored error
 	if n.err != nil {
 		return n.err
@@ -107,6 +126,14 @@ func (n *node) parse(args []string) error {
 			}
 		}
 	}
+	//subcommands inherit their parent's precedence
+	if n.precedence == nil {
+		if n.parent != nil {
+			n.precedence = n.parent.precedence
+		} else {
+			n.precedence = defaultPrecedence
+		}
+	}
 	//add this node and its fields (recurses if has sub-commands)
 	if err := n.addStructFields(defaultGroup, n.item.val); err != nil {
 		return err
@@ -119,6 +146,10 @@ func (n *node) parse(args []string) error {
 	if err := n.addInternalFlags(); err != nil {
 		return err
 	}
+	//flag dependencies may refer to any flag
+	if err := n.resolveFlagDeps(); err != nil {
+		return err
+	}
 	//find defaults from config's package
 	n.setPkgDefaults()
 	//add shortnames where possible
@@ -138,47 +169,62 @@ func (n *node) parse(args []string) error {
 			flagMap[sn] = item
 		}
 	}
+	//keep the defaults, which are restored when reloading config
+	for _, item := range append(n.flags(), n.args...) {
+		item.initial = item.snapshot()
+	}
 	remaining, parseErr := parseFlags(flagMap, args, len(n.cmds) > 0)
 	if parseErr != nil {
 		n.err = parseErr
-		n.internalOpts.Help = true
+		return parseErr
+	}
+	for _, item := range n.flags() {
+		if item.set() {
+			item.setSource(SourceFlag)
+			item.flagged = item.snapshot()
+		}
 	}
 	//handle help, version, install/uninstall
 	if n.internalOpts.Help {
-		return exitOkError(n.Help())
+		return &HelpError{Err: ErrHelp, msg: n.Help()}
 	} else if n.internalOpts.Version {
-		return exitOkError(n.version)
+		return &HelpError{Err: ErrVersion, msg: n.version}
 	} else if n.internalOpts.Install {
 		return n.manageCompletion(false)
 	} else if n.internalOpts.Uninstall {
 		return n.manageCompletion(true)
 	}
-	//first round of defaults, applying env variables where necessary
-	for _, item := range n.flags() {
-		k := item.envName
-		if item.set() || k == "" {
-			continue
-		}
-		v := os.Getenv(k)
-		if v == "" {
-			continue
-		}
-		err := item.Set(v)
-		if err != nil {
-			return fmt.Errorf("flag '%s' cannot set invalid env var (%s): %s", item.name, k, err)
-		}
+	//load .env files before applying env
+	if err := n.loadDotEnv(); err != nil {
+		return err
 	}
-	//second round, unmarshal directly into the struct, overwrites envs and flags
-	if c := n.internalOpts.ConfigPath; c != "" {
-		b, err := ioutil.ReadFile(c)
-		if err == nil {
-			v := n.val.Addr().Interface() //*struct
-			err = json.Unmarshal(b, v)
-			if err != nil {
-				return fmt.Errorf("invalid config file: %s", err)
+	//apply the remaining sources in order of precedence,
+	//each replaces values from lower precedence sources
+	for _, src := range n.precedence {
+		switch src {
+		case SourceEnv:
+			if err := n.applyEnv(); err != nil {
+				return err
+			}
+		case SourceConfig:
+			if err := n.applyConfig(); err != nil {
+				return err
 			}
 		}
 	}
+	//read flag values from --<name>-file flags
+	if err := n.applyFiles(); err != nil {
+		return err
+	}
+	if err := n.applyImplies(); err != nil {
+		return err
+	}
+	//print config after all sources are applied, and
+	//after the selected subcommand (if any) is parsed
+	dump := n.dumping()
+	if dump && len(n.cmds) == 0 {
+		return n.dumpConfig()
+	}
 	//process remaining args
 	i := 0
 	for {
@@ -186,16 +232,21 @@ func (n *node) parse(args []string) error {
 			break
 		}
 		item := n.args[i]
-		if len(remaining) == 0 && !item.set() && !item.slice {
-			return fmt.Errorf("argument '%s' is missing", item.name)
+		if len(remaining) == 0 && !item.set() && !item.slice && !dump {
+			return &MissingArgError{Arg: item.name}
 		}
 		if len(remaining) == 0 {
 			break
 		}
 		s := remaining[0]
+		//positional args replace values from all other sources
+		if item.source != SourceArg && item.set() {
+			item.reset()
+		}
 		if err := item.Set(s); err != nil {
-			return fmt.Errorf("argument '%s' is invalid: %s", item.name, err)
+			return invalidValue(item, s, err, "argument '%s' is invalid: %s", item.name, err)
 		}
+		item.source = SourceArg
 		remaining = remaining[1:]
 		//use next arg?
 		if !item.slice {
@@ -204,11 +255,20 @@ func (n *node) parse(args []string) error {
 	}
 	//check min
 	for _, item := range n.args {
-		if item.slice && item.sets < item.min {
-			return fmt.Errorf("argument '%s' has too few args (%d/%d)", item.name, item.sets, item.min)
+		if item.slice && item.sets < item.min && !dump {
+			return &MissingArgError{
+				Arg: item.name,
+				msg: fmt.Sprintf("argument '%s' has too few args (%d/%d)", item.name, item.sets, item.min),
+			}
 		}
 		if item.slice && item.max != 0 && item.sets > item.max {
-			return fmt.Errorf("argument '%s' has too many args (%d/%d)", item.name, item.sets, item.max)
+			err := fmt.Errorf("has too many args (%d/%d)", item.sets, item.max)
+			return invalidValue(item, "", err, "argument '%s' %s", item.name, err)
+		}
+	}
+	if !dump {
+		if err := n.validate(); err != nil {
+			return err
 		}
 	}
 	//use command? next arg can optionally match command
@@ -223,8 +283,8 @@ func (n *node) parse(args []string) error {
 		}
 		// fallback to pre-initialised cmdname
 		if cmd == "" {
-			if n.cmdnameEnv != "" && os.Getenv(n.cmdnameEnv) != "" {
-				cmd = os.Getenv(n.cmdnameEnv)
+			if n.cmdnameEnv != "" && n.getenv(n.cmdnameEnv) != "" {
+				cmd = n.getenv(n.cmdnameEnv)
 			} else if n.cmdname != nil && *n.cmdname != "" {
 				cmd = *n.cmdname
 			}
@@ -234,7 +294,7 @@ func (n *node) parse(args []string) error {
 		if cmd != "" {
 			sub, exists := n.cmds[cmd]
 			if must && !exists {
-				return fmt.Errorf("command '%s' does not exist", cmd)
+				return &UnknownCommandError{Command: cmd}
 			}
 			if exists {
 				//store matched command
@@ -248,11 +308,105 @@ func (n *node) parse(args []string) error {
 			}
 		}
 	}
+	//no subcommand selected, dump this command
+	if dump {
+		return n.dumpConfig()
+	}
 	//we *should* have consumed all args at this point.
 	//this prevents:  ./foo --bar 42 -z 21 ping --pong 7
 	//where --pong 7 is ignored
 	if len(remaining) != 0 {
-		return fmt.Errorf("unexpected arguments: %s", strings.Join(remaining, " "))
+		return &UnexpectedArgsError{Args: remaining}
+	}
+	return nil
+}
+
+//validate checks the values of all flags once every
+//source has been applied, and again after reloading config
+func (n *node) validate() error {
+	//required flags must be set by now (flag, env or config)
+	missing := []string{}
+	for _, item := range n.flags() {
+		if item.required && item.source == SourceDefault {
+			missing = append(missing, item.name)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingFlagError{Flags: missing}
+	}
+	//value rules
+	for _, item := range append(n.flags(), n.args...) {
+		if err := item.check(); err != nil {
+			return invalidValue(item, "", err, "%s", err)
+		}
+	}
+	//dependent flags
+	for _, item := range n.flags() {
+		if item.source == SourceDefault {
+			continue
+		}
+		for _, r := range item.requires {
+			if r.source == SourceDefault {
+				return constraint([]string{item.name, r.name}, "flag --%s requires --%s", item.name, r.name)
+			}
+		}
+	}
+	//mutually exclusive flags
+	for _, s := range n.flagSets {
+		set := []string{}
+		for _, item := range s.items {
+			if item.source != SourceDefault {
+				set = append(set, "--"+item.name)
+			}
+		}
+		if len(set) > 1 {
+			return constraint(itemNames(s.items), "only one of %s can be set (got %s)", s.flagNames(), strings.Join(set, ", "))
+		} else if len(set) == 0 && s.exact {
+			return constraint(itemNames(s.items), "one of %s is required", s.flagNames())
+		}
+	}
+	return nil
+}
+
+//runValidators calls Validate on each field and struct
+//of this command, then on the selected subcommand
+func (n *node) runValidators() error {
+	for c := n; c != nil; c = c.cmd {
+		for _, item := range append(c.flags(), c.args...) {
+			if item.internal || !item.field.IsValid() {
+				continue
+			}
+			if err := callValidator(item.field); err != nil {
+				e := invalidValue(item, "", err, "%s is invalid: %s", item.label(), err)
+				e.setOpts(c)
+				return e
+			}
+		}
+		for _, s := range c.structs {
+			if err := callValidator(s); err != nil {
+				return &ValidateError{Opts: c, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+//callValidator calls Validate on v or &v, if implemented
+func callValidator(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	vals := []reflect.Value{v}
+	if v.CanAddr() {
+		vals = append(vals, v.Addr())
+	}
+	for _, v := range vals {
+		if !v.CanInterface() {
+			continue
+		}
+		if vr, ok := v.Interface().(Validator); ok {
+			return vr.Validate()
+		}
 	}
 	return nil
 }
@@ -275,9 +429,11 @@ func (n *node) addStructFields(group string, sv reflect.Value) error {
 		sf := sv.Type().Field(i)
 		val := sv.Field(i)
 		if err := n.addStructField(group, sf, val); err != nil {
-			return fmt.Errorf("field '%s' %s", sf.Name, err)
+			return &AuthorError{Opts: n, Msg: fmt.Sprintf("field '%s' %s", sf.Name, err)}
 		}
 	}
+	//fields are validated before their struct
+	n.structs = append(n.structs, sv)
 	return nil
 }
 
@@ -314,9 +470,9 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 	if name == "" {
 		//default to struct field name
 		name = camel2dash(fName)
-		//slice? use singular, usage of
+		//slice or map? use singular, usage of
 		//Foos []string should be: --foo bar --foo bazz
-		if val.Type().Kind() == reflect.Slice {
+		if k := val.Type().Kind(); k == reflect.Slice || k == reflect.Map {
 			name = getSingular(name)
 		}
 	}
@@ -346,7 +502,7 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 	if mode == "cmdname" {
 		if name, ok := kv.take("env"); ok {
 			if name == "" {
-				name = camel2const(fName)
+				name = n.envName(fName)
 			}
 			n.cmdnameEnv = name
 		}
@@ -365,16 +521,88 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 	if err != nil {
 		return err
 	}
+	i.internal = internal
+	i.field = val
+	//counters are int flags which increment on each use
+	if mode == "count" {
+		switch i.val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		default:
+			return n.errorf("count flag '%s' must be an int", name)
+		}
+		if m, ok := kv.take("max"); ok {
+			max, err := strconv.Atoi(m)
+			if err != nil {
+				return n.errorf("max not an integer")
+			}
+			i.max = max
+		}
+		i.counter = true
+		i.noarg = true
+		mode = "flag"
+	}
 	i.mode = mode
 	i.name = name
+	i.fieldName = fName
 	i.help = help
+	//maps can customise how entries are parsed
+	if i.mapping {
+		if sep, ok := kv.take("kvsep"); ok {
+			if sep == "" {
+				return n.errorf("kvsep on '%s' cannot be empty", name)
+			}
+			i.kvsep = sep
+		}
+		if d, ok := kv.take("dup"); ok {
+			if d != "first" && d != "last" && d != "error" {
+				return n.errorf("dup on '%s' must be one of: first, last, error", name)
+			}
+			i.dup = d
+		}
+	}
+	//split values on a delimiter, defaults to comma
+	if sep, ok := kv.take("sep"); ok {
+		if !i.slice && !i.mapping {
+			return n.errorf("sep on '%s' requires a slice or map", name)
+		}
+		if sep == "" {
+			sep = ","
+		}
+		i.sep = sep
+	}
+	//keep default values when appending
+	if _, ok := kv.take("append"); ok {
+		if !i.slice && !i.mapping {
+			return n.errorf("append on '%s' requires a slice or map", name)
+		}
+		i.append = true
+	}
+	//restrict values, overrides the Chooser interface
+	if c, ok := kv.take("choices"); ok {
+		if c == "" {
+			return n.errorf("choices on '%s' cannot be empty", name)
+		}
+		i.choices = strings.Split(c, "|")
+	}
 	//insert either as flag or as argument
 	switch mode {
 	case "flag":
 		//set default text
 		if d, ok := kv.take("default"); ok {
 			i.defstr = d
-		} else if !i.slice {
+		} else if i.slice || i.mapping {
+			i.defstr = i.defaultString()
+		} else if val.Kind() == reflect.Ptr {
+			//non-nil pointers always have a default
+			if !val.IsNil() {
+				v := val.Interface()
+				if s, ok := v.(fmt.Stringer); ok {
+					i.defstr = s.String()
+				} else {
+					i.defstr = fmt.Sprintf("%v", val.Elem().Interface())
+				}
+			}
+		} else {
 			v := val.Interface()
 			t := val.Type()
 			z := reflect.Zero(t)
@@ -383,26 +611,46 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 				i.defstr = fmt.Sprintf("%v", v)
 			}
 		}
-		if e, ok := kv.take("env"); ok || n.useEnv {
-			explicit := true
-			if e == "" {
-				explicit = false
-				e = camel2const(i.name)
-			}
-			_, set := n.envNames[e]
-			if set && explicit {
-				return n.errorf("env name '%s' already in use", e)
-			}
-			if !internal && !set {
-				n.envNames[e] = true
-				i.envName = e
-				i.useEnv = true
+		if err := n.addEnv(kv, i, internal); err != nil {
+			return err
+		}
+		if err := n.addRules(kv, i); err != nil {
+			return err
+		}
+		//flags can be marked as required
+		if _, ok := kv.take("required"); ok {
+			i.required = true
+		}
+		//flags can depend on other flags, resolved once all flags are added
+		if r, ok := kv.take("requires"); ok {
+			i.requiresNames = strings.Split(r, "|")
+		}
+		if r, ok := kv.take("implies"); ok {
+			i.impliesNames = strings.Split(r, "|")
+		}
+		//flags can be mutually exclusive with other flags
+		for _, k := range []string{"xor", "oneof"} {
+			if set, ok := kv.take(k); ok {
+				if err := n.addFlagSet(set, k == "oneof", i); err != nil {
+					return err
+				}
 			}
 		}
 		//cannot have duplicates
 		if _, ok := n.flagNames[name]; ok {
 			return n.errorf("flag '%s' already exists", name)
 		}
+		//bool flags can be negated with --no-<name>
+		if _, ok := kv.take("negatable"); ok {
+			if !i.noarg || i.counter {
+				return n.errorf("negatable flag '%s' must be a bool", name)
+			}
+			if _, ok := n.flagNames["no-"+name]; ok {
+				return n.errorf("flag 'no-%s' already exists", name)
+			}
+			n.flagNames["no-"+name] = true
+			i.negatable = true
+		}
 		//flags can also set short names
 		if short, ok := kv.take("short"); ok {
 			if short == "-" {
@@ -420,7 +668,16 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 		n.flagNames[name] = true
 		g := n.flagGroup(group)
 		g.flags = append(g.flags, i)
+		//values can also be read from a file
+		if _, ok := kv.take("file"); ok {
+			if err := n.addFileFlag(g, i); err != nil {
+				return err
+			}
+		}
 	case "arg":
+		if i.mapping {
+			return n.errorf("arg '%s' cannot be a map", name)
+		}
 		//minimum number of items
 		if i.slice {
 			if m, ok := kv.take("min"); ok {
@@ -438,6 +695,13 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 				i.max = max
 			}
 		}
+		if err := n.addRules(kv, i); err != nil {
+			return err
+		}
+		//args can also be set by env
+		if err := n.addEnv(kv, i, internal); err != nil {
+			return err
+		}
 		//validations
 		if group != "" {
 			return n.errorf("args cannot be placed into a group")
@@ -458,6 +722,186 @@ func (n *node) addKVField(kv *kv, fName, help, mode, group string, val reflect.V
 	return nil
 }
 
+//addFileFlag adds a --<name>-file flag (and <NAME>_FILE env)
+//after the given flag, which is set from the contents of the file
+func (n *node) addFileFlag(g *itemGroup, i *item) error {
+	if i.noarg {
+		return n.errorf("file flag '%s' cannot be a bool or count", i.name)
+	}
+	name := i.name + "-file"
+	if _, ok := n.flagNames[name]; ok {
+		return n.errorf("flag '%s' already exists", name)
+	}
+	f, err := newItem(reflect.New(reflect.TypeOf("")).Elem())
+	if err != nil {
+		return err
+	}
+	f.mode = "flag"
+	f.name = name
+	f.fieldName = i.fieldName + "File"
+	f.help = "read --" + i.name + " from a file"
+	f.fileFor = i
+	e := i.envName
+	if e == "" {
+		e = n.envName(i.name)
+	}
+	e += "_FILE"
+	if _, ok := n.envNames[e]; ok {
+		return n.errorf("env name '%s' already in use", e)
+	}
+	n.envNames[e] = true
+	f.envName = e
+	f.useEnv = true
+	i.fileRef = true
+	n.flagNames[name] = true
+	n.flagSkipShort[name] = true
+	g.flags = append(g.flags, f)
+	return nil
+}
+
+//addRules parses the value validation keys of the item
+func (n *node) addRules(kv *kv, i *item) error {
+	r := &i.rules
+	for _, k := range []string{"min", "max"} {
+		v, ok := kv.take(k)
+		if !ok {
+			continue
+		}
+		switch {
+		case i.slice:
+			//number of values
+			c, err := strconv.Atoi(v)
+			if err != nil {
+				return n.errorf("%s not an integer", k)
+			}
+			if k == "min" {
+				i.min = c
+			} else {
+				i.max = c
+			}
+		case i.numeric():
+			f, err := i.parseNumber(v)
+			if err != nil {
+				return n.errorf("%s on '%s' is not a number: %s", k, i.name, v)
+			}
+			if k == "min" {
+				r.min, r.minStr = &f, v
+			} else {
+				r.max, r.maxStr = &f, v
+			}
+		default:
+			return n.errorf("%s on '%s' requires a number or a slice", k, i.name)
+		}
+	}
+	if p, ok := kv.take("pattern"); ok {
+		k := i.val.Kind()
+		if i.slice {
+			k = i.val.Type().Elem().Kind()
+		}
+		if k != reflect.String {
+			return n.errorf("pattern on '%s' requires a string", i.name)
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return n.errorf("pattern on '%s' is invalid: %s", i.name, err)
+		}
+		r.pattern = re
+	}
+	sized := i.slice || i.mapping || i.val.Kind() == reflect.String
+	if l, ok := kv.take("len"); ok {
+		if !sized {
+			return n.errorf("len on '%s' requires a string, slice or map", i.name)
+		}
+		min, max, err := parseRange(l)
+		if err != nil {
+			return n.errorf("len on '%s' is invalid: %s", i.name, err)
+		}
+		r.len, r.minLen, r.maxLen = true, min, max
+	}
+	if _, ok := kv.take("nonempty"); ok {
+		if !sized {
+			return n.errorf("nonempty on '%s' requires a string, slice or map", i.name)
+		}
+		r.nonempty = true
+	}
+	return nil
+}
+
+//resolveFlagDeps finds the flags named by requires and implies
+func (n *node) resolveFlagDeps() error {
+	find := func(name string) *item {
+		for _, item := range n.flags() {
+			if item.name == name {
+				return item
+			}
+		}
+		return nil
+	}
+	for _, i := range n.flags() {
+		for _, r := range i.requiresNames {
+			d := find(r)
+			if d == nil || d == i {
+				return n.errorf("flag '%s' requires unknown flag '%s'", i.name, r)
+			}
+			i.requires = append(i.requires, d)
+		}
+		for _, r := range i.impliesNames {
+			d := find(r)
+			if d == nil || d == i {
+				return n.errorf("flag '%s' implies unknown flag '%s'", i.name, r)
+			}
+			if !d.noarg || d.counter {
+				return n.errorf("flag '%s' implies '%s', which must be a bool", i.name, r)
+			}
+			i.implies = append(i.implies, d)
+		}
+	}
+	return nil
+}
+
+//addFlagSet adds the item to the named set of mutually exclusive
+//flags. exact sets (oneof) require exactly one of their flags.
+func (n *node) addFlagSet(name string, exact bool, i *item) error {
+	if name == "" {
+		return n.errorf("flag '%s' must name its flag set", i.name)
+	}
+	for _, s := range n.flagSets {
+		if s.name == name {
+			if s.exact != exact {
+				return n.errorf("flag set '%s' cannot use both xor and oneof", name)
+			}
+			s.items = append(s.items, i)
+			return nil
+		}
+	}
+	n.flagSets = append(n.flagSets, &flagSet{name: name, exact: exact, items: []*item{i}})
+	return nil
+}
+
+//addEnv sets the env name of the item, using the
+//"env" key, UseEnv or EnvPrefix
+func (n *node) addEnv(kv *kv, i *item, internal bool) error {
+	e, ok := kv.take("env")
+	if !ok && !n.envEnabled() {
+		return nil
+	}
+	explicit := true
+	if e == "" {
+		explicit = false
+		e = n.envName(i.name)
+	}
+	_, set := n.envNames[e]
+	if set && explicit {
+		return n.errorf("env name '%s' already in use", e)
+	}
+	if !internal && !set {
+		n.envNames[e] = true
+		i.envName = e
+		i.useEnv = true
+	}
+	return nil
+}
+
 func (n *node) setCmdName(val reflect.Value) error {
 	if n.cmdname != nil {
 		return n.errorf("cmdname set twice")
@@ -524,7 +968,17 @@ func (n *node) addInternalFlags() error {
 	}
 	if n.userCfgPath {
 		flags = append(flags,
-			internal{name: "ConfigPath", help: "path to a JSON file"},
+			internal{name: "ConfigPath", help: "path to a config file"},
+		)
+	}
+	if len(n.configPaths) > 0 || n.xdgConfig {
+		flags = append(flags,
+			internal{name: "ConfigDebug", help: "print which config files were loaded"},
+		)
+	}
+	if n.root().userDumpConfig {
+		flags = append(flags,
+			internal{name: "DumpConfig", help: "print the resolved config and exit"},
 		)
 	}
 	for _, i := range flags {
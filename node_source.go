@@ -0,0 +1,30 @@
+package opts
+
+//Source returns where the value of the named item came from
+func (n *node) Source(name string) Source {
+	if i := n.findItem(name); i != nil {
+		return i.source
+	}
+	return SourceDefault
+}
+
+//IsSet returns whether the named item was provided by any source
+func (n *node) IsSet(name string) bool {
+	return n.Source(name) != SourceDefault
+}
+
+//findItem finds a flag or arg by its name or by its struct field name
+func (n *node) findItem(name string) *item {
+	items := append(n.flags(), n.args...)
+	for _, i := range items {
+		if i.name == name {
+			return i
+		}
+	}
+	for _, i := range items {
+		if i.fieldName == name {
+			return i
+		}
+	}
+	return nil
+}
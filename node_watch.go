@@ -0,0 +1,193 @@
+package opts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//watchInterval is how often config files are checked for changes
+var watchInterval = time.Second
+
+//Watch polls the config files for changes until ctx is done. See ParsedOpts.
+func (n *node) Watch(ctx context.Context, fn func(changed []string)) error {
+	//compare against the files as they were when parsed
+	files := []string{}
+	last := ""
+	for _, c := range n.chain() {
+		files = append(files, c.configFiles()...)
+		last += c.configStat
+	}
+	if len(files) == 0 {
+		return errors.New("no config files to watch")
+	}
+	t := time.NewTicker(watchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		curr := statFiles(files)
+		if curr == last {
+			continue
+		}
+		last = curr
+		changed, err := n.reload()
+		if err != nil {
+			if r := n.root(); r.watchError != nil {
+				r.watchError(err)
+			} else {
+				fmt.Fprintf(os.Stderr, "warning: config reload failed: %s\n", err)
+			}
+			continue
+		}
+		if len(changed) > 0 {
+			fn(changed)
+		}
+	}
+}
+
+//RLock must be held while reading the struct if it may be
+//modified concurrently by Watch
+func (n *node) RLock() {
+	n.root().mu.RLock()
+}
+
+//RUnlock releases RLock
+func (n *node) RUnlock() {
+	n.root().mu.RUnlock()
+}
+
+func (n *node) root() *node {
+	r := n
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+//chain returns this command and its selected subcommands
+func (n *node) chain() []*node {
+	nodes := []*node{}
+	for c := n; c != nil; c = c.cmd {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+//statFiles returns a summary of the modification
+//time and size of each file, empty if missing
+func statFiles(files []string) string {
+	sb := strings.Builder{}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			fmt.Fprintf(&sb, "%s:%d:%d\n", f, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fmt.Fprintf(&sb, "%s:-\n", f)
+		}
+	}
+	return sb.String()
+}
+
+//reload restores every item set by the config file (or not set
+//at all) to its default, then reapplies env and config. items
+//set by flags or args are never modified. if the result is invalid,
+//all items are rolled back. returns the names of the changed items,
+//where subcommand items are prefixed with the subcommand name.
+func (n *node) reload() ([]string, error) {
+	mu := &n.root().mu
+	mu.Lock()
+	defer mu.Unlock()
+	type reloadItem struct {
+		name   string
+		item   *item
+		before *itemState
+		value  interface{}
+	}
+	items := []*reloadItem{}
+	chain := n.chain()
+	prefix := ""
+	for _, c := range chain {
+		if c != n {
+			prefix += c.name + "."
+		}
+		c.reloadItems = map[*item]bool{}
+		for _, i := range append(c.flags(), c.args...) {
+			if i.internal || i.initial == nil {
+				continue
+			}
+			//keep values from higher precedence sources
+			if c.rank(i.source) > c.rank(SourceConfig) {
+				continue
+			}
+			c.reloadItems[i] = true
+			items = append(items, &reloadItem{
+				name:   prefix + i.name,
+				item:   i,
+				before: i.snapshot(),
+				value:  i.configValue(),
+			})
+		}
+	}
+	defer func() {
+		for _, c := range chain {
+			c.reloadItems = nil
+		}
+	}()
+	apply := func() error {
+		//start again from the defaults and flag values,
+		//then reapply env and config in order of precedence
+		for _, r := range items {
+			s := r.item.initial
+			if r.item.flagged != nil {
+				s = r.item.flagged
+			}
+			if err := r.item.restore(s); err != nil {
+				return err
+			}
+		}
+		for _, c := range chain {
+			for _, src := range c.precedence {
+				var err error
+				switch src {
+				case SourceEnv:
+					err = c.applyEnv()
+				case SourceConfig:
+					err = c.applyConfig()
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := c.applyFiles(); err != nil {
+				return err
+			}
+			if err := c.applyImplies(); err != nil {
+				return err
+			}
+			if err := c.validate(); err != nil {
+				return err
+			}
+		}
+		return n.root().runValidators()
+	}
+	if err := apply(); err != nil {
+		for _, r := range items {
+			r.item.restore(r.before)
+		}
+		return nil, err
+	}
+	changed := []string{}
+	for _, r := range items {
+		if !reflect.DeepEqual(r.value, r.item.configValue()) {
+			changed = append(changed, r.name)
+		}
+	}
+	return changed, nil
+}
@@ -1,6 +1,7 @@
 package opts
 
 import (
+	"context"
 	"flag"
 	"reflect"
 )
@@ -16,17 +17,66 @@ type Opts interface {
 	//Version of the command. Commonly set using a package main variable at compile
 	//time using ldflags (for example, go build -ldflags -X main.version=42).
 	Version(version string) Opts
-	//ConfigPath is a path to a JSON file to use as defaults. This is useful in
+	//ConfigPath is a path to a config file to use as defaults. This is useful in
 	//global paths like /etc/my-prog.json. For a user-specified path. Use the
-	//UserConfigPath method.
+	//UserConfigPath method. The file format is chosen by its extension (see
+	//ConfigFormat), and keys are flag names (for example "max-conns"). Objects
+	//keyed by a subcommand name configure that subcommand.
 	ConfigPath(path string) Opts
+	//ConfigPaths adds config files which are merged in order, so values in
+	//later files override earlier files. Files which do not exist are skipped.
+	//ConfigPath (or --config-path) is always merged last.
+	ConfigPaths(paths ...string) Opts
+	//XDGConfig adds the config search paths /etc/<name>/config.<ext>,
+	//$XDG_CONFIG_HOME/<name>/config.<ext> and <name>.<ext> in the working
+	//directory, where <ext> is any known config format. These are merged
+	//before ConfigPaths.
+	XDGConfig() Opts
+	//ConfigFormat sets the format of the config file, instead of using its file
+	//extension. Built-in formats are "json" (the default) and "env" (dotenv).
+	//Other formats may be added with ConfigDecoder.
+	ConfigFormat(format string) Opts
+	//ConfigDecoder adds a decoder for the given config format, which is matched
+	//against config file extensions (for example "yaml" or "toml"). This allows
+	//any format to be supported without adding dependencies to opts.
+	ConfigDecoder(format string, decoder ConfigDecoder) Opts
+	//ConfigStrict causes unknown config file keys to fail parsing,
+	//instead of printing a warning.
+	ConfigStrict() Opts
 	//UserConfigPath is the same as ConfigPath however an extra flag (--config-path)
 	//is added to this Opts instance to give the user control of the filepath.
 	//Configuration unmarshalling occurs after flag parsing.
 	UserConfigPath() Opts
+	//UserDumpConfig adds the --dump-config flag, which prints the resolved
+	//config (see ParsedOpts.DumpConfig) and exits. The flag is also added
+	//to subcommands, and the selected subcommand is always included.
+	UserDumpConfig() Opts
+	//Precedence sets the order in which value sources are applied, from
+	//lowest to highest. Each source replaces values from lower precedence
+	//sources. It must list each of SourceConfig, SourceEnv and SourceFlag.
+	//By default, flags override environment variables, which override the
+	//config file. Struct defaults are always lowest and positional arguments
+	//are always highest. Subcommands inherit this setting.
+	Precedence(sources ...Source) Opts
+	//WatchError sets a function which is called with the error when
+	//Watch fails to reload the config, instead of printing a warning.
+	WatchError(fn func(err error)) Opts
 	//UseEnv enables the default environment variables on all fields. This is
-	//equivalent to adding the opts tag "env" on all flag fields.
+	//equivalent to adding the opts tag "env" on all flag and arg fields.
+	//Subcommands inherit this setting.
 	UseEnv() Opts
+	//EnvPrefix prefixes all derived environment variable names (and implies
+	//UseEnv). For example, with EnvPrefix("MYAPP"), the --port flag is read from
+	//MYAPP_PORT. Subcommands inherit the prefix with their name appended, so a
+	//"serve" subcommand's --port flag is read from MYAPP_SERVE_PORT. Explicit
+	//names (opts:"env=NAME") are not prefixed.
+	EnvPrefix(prefix string) Opts
+	//DotEnv reads environment variables from the given dotenv files, which
+	//support quotes, comments, "export" prefixes and ${VAR} expansion. Later
+	//files override earlier files, and the real environment overrides all
+	//files. Files which do not exist are skipped. The process environment is
+	//not modified. Subcommands inherit these variables.
+	DotEnv(paths ...string) Opts
 	//Complete enables auto-completion for this command. When enabled, two extra
 	//flags are added (--install and --uninstall) which can be used to install
 	//a dynamic shell (bash, zsh, fish) completion for this command. Internally,
@@ -85,7 +135,8 @@ type Opts interface {
 	//the first arg. Parse failures will call os.Exit.
 	ParseArgs(args []string) ParsedOpts
 	//ParseArgsError is the same as ParseArgs except you can
-	//handle the error.
+	//handle the error. See ErrHelp, ErrVersion and the *Error
+	//types, which carry the command that failed.
 	ParseArgsError(args []string) (ParsedOpts, error)
 }
 
@@ -102,6 +153,70 @@ type ParsedOpts interface {
 	RunFatal()
 	//Selected returns the subcommand picked when parsing the command line
 	Selected() ParsedOpts
+	//Source returns where the value of the given flag or argument came from.
+	//The name may be either the flag name or the struct field name. Only
+	//this command's fields are searched, use Selected() for subcommands.
+	//Unknown names return SourceDefault.
+	Source(name string) Source
+	//IsSet returns whether the given flag or argument was provided by
+	//any source (the command-line, an environment variable or the config file).
+	IsSet(name string) bool
+	//DumpConfig returns the resolved values of all flags (including the
+	//selected subcommands) as a config file, using the config file format
+	//(JSON by default). Help text is included as comments, where the
+	//format supports them.
+	DumpConfig() (string, error)
+	//Watch polls the config files for changes until ctx is done, which is
+	//returned as the error. On change, values which were set by the config
+	//file, or by a source with a lower precedence (or not set at all) are
+	//reloaded, while values from higher precedence sources are kept.
+	//Flag values are reloaded only when flags have a lower precedence than
+	//the config file. If the reloaded config is invalid, all values are
+	//rolled back and a warning is printed (see WatchError). Otherwise, fn is called with the names of the changed
+	//flags (subcommand flags are prefixed, e.g. "serve.port"). Watch is
+	//typically run in a goroutine, in which case the struct must only be read
+	//while holding RLock:
+	//
+	//	o.RLock()
+	//	port := c.Port
+	//	o.RUnlock()
+	Watch(ctx context.Context, fn func(changed []string)) error
+	//RLock locks the struct for reading, see Watch
+	RLock()
+	//RUnlock unlocks the struct, see Watch
+	RUnlock()
+}
+
+//Source describes where the value of a flag or argument came from
+type Source int
+
+const (
+	//SourceDefault is the initial value from the struct
+	SourceDefault Source = iota
+	//SourceConfig is a value from the config file
+	SourceConfig
+	//SourceEnv is a value from an environment variable
+	SourceEnv
+	//SourceFlag is a value from a command-line flag
+	SourceFlag
+	//SourceArg is a value from a command-line argument
+	SourceArg
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceConfig:
+		return "config"
+	case SourceEnv:
+		return "env"
+	case SourceFlag:
+		return "flag"
+	case SourceArg:
+		return "arg"
+	}
+	return "unknown"
 }
 
 //New creates a new Opts instance using the given configuration
@@ -121,3 +236,18 @@ func Parse(config interface{}) ParsedOpts {
 type Setter interface {
 	Set(string) error
 }
+
+//Chooser is any type which restricts its values to
+//a fixed set of strings. Choices are validated when set,
+//displayed in the help text and used for shell-completion.
+type Chooser interface {
+	Choices() []string
+}
+
+//Validator is any field or struct (including embedded
+//structs and subcommands) which checks its own values.
+//Validate is called after parsing and after each config
+//reload, and its error is shown with the help text.
+type Validator interface {
+	Validate() error
+}
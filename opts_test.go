@@ -1,6 +1,8 @@
 package opts
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -10,6 +12,9 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/posener/complete"
 )
 
 func TestStrings(t *testing.T) {
@@ -200,7 +205,7 @@ func TestUnsupportedType(t *testing.T) {
 	//config
 	type Config struct {
 		Foo string
-		Bar map[string]bool
+		Bar map[string][]string
 	}
 	c := Config{}
 	//flag example parse
@@ -382,7 +387,7 @@ func TestJSON(t *testing.T) {
 		t.Fatal(err)
 	}
 	check(t, c.Foo, `hello`)
-	check(t, c.Bar, 7) //currently uses JSON value... might change...
+	check(t, c.Bar, 8) //flags override the config file
 }
 
 func TestArg(t *testing.T) {
@@ -723,7 +728,7 @@ func TestCmdGroupRootValidation(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for Group on root")
 	}
-	if _, ok := err.(authorError); !ok {
+	if _, ok := err.(*AuthorError); !ok {
 		t.Fatalf("expected authorError, got: %T: %s", err, err)
 	}
 }
@@ -862,6 +867,2160 @@ func TestFlagEqualsValue(t *testing.T) {
 	check(t, c.Foo, "hello")
 }
 
+func TestRequired(t *testing.T) {
+	type Config struct {
+		Foo string `opts:"required"`
+		Bar int    `opts:"required"`
+		Baz bool
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--baz"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	check(t, err.Error(), "missing required flags: --foo, --bar")
+	//all present
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--foo", "hello", "--bar", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "hello")
+	check(t, c.Bar, 7)
+}
+
+func TestRequiredEnvConfig(t *testing.T) {
+	os.Setenv("FOO", "from-env")
+	defer os.Unsetenv("FOO")
+	p := filepath.Join(os.TempDir(), "opts-required.json")
+	if err := ioutil.WriteFile(p, []byte(`{"bar":0}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Foo string `opts:"required,env"`
+		Bar int    `opts:"required"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "from-env")
+	check(t, c.Bar, 0)
+}
+
+func TestDocRequired(t *testing.T) {
+	type Config struct {
+		Foo string `opts:"required,help=a message"`
+		Bar string `opts:"required"`
+	}
+	c := &Config{Bar: "zip"}
+	o, _ := New(c).Name("docrequired").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docrequired [options]
+
+  Options:
+  --foo, -f   a message (required)
+  --bar, -b   required, default zip
+  --help, -h  display help
+
+`)
+}
+
+func TestChoices(t *testing.T) {
+	type Config struct {
+		Format string   `opts:"choices=json|yaml|table"`
+		Tags   []string `opts:"choices=a|b"`
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--format", "yaml", "--tag", "a", "--tag", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Format, "yaml")
+	check(t, c.Tags, []string{"a", "b"})
+	c = &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--format", "xml"})
+	if err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), `invalid value "xml" for flag --format: must be one of: json, yaml, table`) {
+		t.Fatalf("expected choices error, got: %s", err)
+	}
+}
+
+type testColour string
+
+func (testColour) Choices() []string {
+	return []string{"red", "green"}
+}
+
+func TestChoicesInterface(t *testing.T) {
+	type Config struct {
+		Colour testColour `opts:"mode=arg"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "blue"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	check(t, err.Error(), "argument 'colour' is invalid: must be one of: red, green")
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "green"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Colour, testColour("green"))
+}
+
+func TestDocChoices(t *testing.T) {
+	type Config struct {
+		Colour testColour `opts:"mode=arg,help=the colour"`
+		Format string     `opts:"choices=json|yaml,help=output format"`
+	}
+	c := &Config{Format: "json"}
+	o, _ := New(c).Name("docchoices").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docchoices [options] <colour>
+
+  the colour (one of red|green)
+
+  Options:
+  --format, -f  output format (one of json|yaml, default json)
+  --help, -h    display help
+
+`)
+}
+
+func TestCompleteChoices(t *testing.T) {
+	type Config struct {
+		Format string `opts:"choices=json|yaml|table"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.parse([]string{"/bin/prog"})
+	p := n.nodeCompletion().Flags["--format"]
+	check(t, p.Predict(complete.Args{Last: "t"}), []string{"table"})
+	check(t, p.Predict(complete.Args{Last: ""}), []string{"json", "yaml", "table"})
+}
+
+func TestCompleteArgChoices(t *testing.T) {
+	type Config struct {
+		Format string `opts:"choices=json|yaml"`
+		Fast   bool
+		Colour testColour `opts:"mode=arg"`
+		Size   string     `opts:"mode=arg,choices=small|large"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.parse([]string{"/bin/prog"})
+	p := n.nodeCompletion().Args
+	check(t, p.Predict(complete.Args{Completed: []string{"--format", "json"}}), []string{"red", "green"})
+	check(t, p.Predict(complete.Args{Completed: []string{"-f", "json", "--fast", "red"}}), []string{"small", "large"})
+	check(t, p.Predict(complete.Args{Completed: []string{"--format=json", "red"}}), []string{"small", "large"})
+}
+
+func TestNegatable(t *testing.T) {
+	type Config struct {
+		Color bool `opts:"negatable"`
+		Fast  bool `opts:"negatable"`
+	}
+	c := &Config{Color: true}
+	if err := testNew(c).parse([]string{"/bin/prog", "--no-color", "--fast"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Color, false)
+	check(t, c.Fast, true)
+	//non-negatable bools are not affected
+	type Config2 struct {
+		Color bool
+	}
+	c2 := &Config2{}
+	if err := testNew(c2).parse([]string{"/bin/prog", "--no-color"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "unknown flag: --no-color") {
+		t.Fatalf("expected unknown flag error, got: %s", err)
+	}
+}
+
+func TestNegatableClash(t *testing.T) {
+	type Config struct {
+		Color   bool `opts:"negatable"`
+		NoColor bool
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "flag 'no-color' already exists") {
+		t.Fatalf("expected already exists error, got: %s", err)
+	}
+	type Config2 struct {
+		Name string `opts:"negatable"`
+	}
+	if err := testNew(&Config2{}).parse([]string{"/bin/prog"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "must be a bool") {
+		t.Fatalf("expected bool error, got: %s", err)
+	}
+}
+
+func TestDocNegatable(t *testing.T) {
+	type Config struct {
+		Color bool `opts:"negatable,help=colorize output"`
+	}
+	c := &Config{Color: true}
+	n := testNew(c)
+	o, _ := n.Name("docnegatable").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docnegatable [options]
+
+  Options:
+  --[no-]color, -c  colorize output (default true)
+  --help, -h        display help
+
+`)
+	if _, ok := n.nodeCompletion().Flags["--no-color"]; !ok {
+		t.Fatal("expected --no-color completion")
+	}
+}
+
+func TestShortCluster(t *testing.T) {
+	type Config struct {
+		Extract bool `opts:"short=x"`
+		Verbose bool
+		File    string
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-xvf", "file.tar"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Extract, true)
+	check(t, c.Verbose, true)
+	check(t, c.File, "file.tar")
+	//attached value
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-vffile.tar"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Extract, false)
+	check(t, c.Verbose, true)
+	check(t, c.File, "file.tar")
+	//unknown
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-xz"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "unknown flag: -z in -xz") {
+		t.Fatalf("expected unknown flag error, got: %s", err)
+	}
+}
+
+func TestShortAttachedValue(t *testing.T) {
+	type Config struct {
+		Num   int `opts:"short=n"`
+		Port  int
+		Lines int
+	}
+	c := &Config{}
+	//single dash long names still match exactly
+	if err := testNew(c).parse([]string{"/bin/prog", "-n5", "-p8080", "-lines", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Num, 5)
+	check(t, c.Port, 8080)
+	check(t, c.Lines, 3)
+}
+
+func TestCounter(t *testing.T) {
+	type Config struct {
+		Verbose int `opts:"mode=count"`
+		Quiet   bool
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-vvq", "--verbose", "-v"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, 4)
+	check(t, c.Quiet, true)
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--verbose=3"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, 3)
+}
+
+func TestCounterMax(t *testing.T) {
+	type Config struct {
+		Verbose int `opts:"mode=count,max=2"`
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-vv"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, 2)
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "-vvv"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "flag -v exceeds max count (2)") {
+		t.Fatalf("expected max count error, got: %s", err)
+	}
+	type Config2 struct {
+		Verbose string `opts:"mode=count"`
+	}
+	if err := testNew(&Config2{}).parse([]string{"/bin/prog"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "must be an int") {
+		t.Fatalf("expected int error, got: %s", err)
+	}
+}
+
+func TestDocCounter(t *testing.T) {
+	type Config struct {
+		Verbose int `opts:"mode=count,help=verbosity level"`
+	}
+	c := &Config{}
+	o, _ := New(c).Name("doccounter").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: doccounter [options]
+
+  Options:
+  --verbose, -v  verbosity level (allows multiple)
+  --help, -h     display help
+
+`)
+}
+
+func TestMap(t *testing.T) {
+	type Config struct {
+		Labels  map[string]string
+		Headers map[string]string `opts:"kvsep=:"`
+		Limits  map[string]int
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog",
+		"--label", "env=prod", "--label", "team=infra",
+		"--header", "Accept:text/plain",
+		"--limit", "cpu=2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Labels, map[string]string{"env": "prod", "team": "infra"})
+	check(t, c.Headers, map[string]string{"Accept": "text/plain"})
+	check(t, c.Limits, map[string]int{"cpu": 2})
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--limit", "cpu=two"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), `invalid value "cpu=two" for flag --limit`) {
+		t.Fatalf("expected invalid value error, got: %s", err)
+	}
+}
+
+func TestMapDup(t *testing.T) {
+	type Config struct {
+		First map[string]string `opts:"dup=first"`
+		Last  map[string]string
+		Error map[string]string `opts:"dup=error"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog",
+		"--first", "a=1", "--first", "a=2",
+		"--last", "a=1", "--last", "a=2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.First, map[string]string{"a": "1"})
+	check(t, c.Last, map[string]string{"a": "2"})
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--error", "a=1", "--error", "a=2"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "duplicate key 'a'") {
+		t.Fatalf("expected duplicate key error, got: %s", err)
+	}
+}
+
+func TestMapEnvConfig(t *testing.T) {
+	os.Setenv("LABELS", "env=prod,team=infra")
+	defer os.Unsetenv("LABELS")
+	p := filepath.Join(os.TempDir(), "opts-map.json")
+	if err := ioutil.WriteFile(p, []byte(`{"limits":{"cpu":4}}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Labels map[string]string `opts:"env=LABELS"`
+		Limits map[string]int
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog", "--limit", "mem=512"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Labels, map[string]string{"env": "prod", "team": "infra"})
+	check(t, c.Limits, map[string]int{"cpu": 4, "mem": 512})
+}
+
+func TestDocMap(t *testing.T) {
+	type Config struct {
+		Labels  map[string]string `opts:"help=resource labels"`
+		Headers map[string]string `opts:"kvsep=:"`
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docmap").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docmap [options]
+
+  Options:
+  --label, -l   resource labels (key=value, allows multiple)
+  --header, -h  key:value, allows multiple
+  --help        display help
+
+`)
+}
+
+func TestSep(t *testing.T) {
+	type Config struct {
+		Tags   []string          `opts:"sep"`
+		Ports  []int             `opts:"sep=;"`
+		Labels map[string]string `opts:"sep"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog",
+		"--tag", "a,b", "--tag", `c\,d`,
+		"--port", "80;443",
+		"--label", "env=prod,team=infra",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Tags, []string{"a", "b", "c,d"})
+	check(t, c.Ports, []int{80, 443})
+	check(t, c.Labels, map[string]string{"env": "prod", "team": "infra"})
+	type Config2 struct {
+		Tag string `opts:"sep"`
+	}
+	if err := testNew(&Config2{}).parse([]string{"/bin/prog"}); err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(err.Error(), "requires a slice or map") {
+		t.Fatalf("expected slice error, got: %s", err)
+	}
+}
+
+func TestSepEnv(t *testing.T) {
+	os.Setenv("TAGS", "a,b,c")
+	os.Setenv("HOSTS", "x,y")
+	defer os.Unsetenv("TAGS")
+	defer os.Unsetenv("HOSTS")
+	type Config struct {
+		Tags  []string `opts:"sep,env=TAGS"`
+		Hosts []string `opts:"env=HOSTS"`
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Tags, []string{"a", "b", "c"})
+	check(t, c.Hosts, []string{"x,y"})
+}
+
+func TestSliceDefault(t *testing.T) {
+	type Config struct {
+		Upstreams []string
+		Extras    []string          `opts:"append"`
+		Labels    map[string]string `opts:"append"`
+	}
+	defaults := []string{"a", "b"}
+	c := &Config{
+		Upstreams: defaults,
+		Extras:    []string{"x"},
+		Labels:    map[string]string{"env": "dev"},
+	}
+	//no flags keeps defaults
+	if err := testNew(c).parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Upstreams, []string{"a", "b"})
+	//user values replace, unless appending
+	err := testNew(c).parse([]string{"/bin/prog",
+		"--upstream", "c", "--upstream", "d",
+		"--extra", "y",
+		"--label", "team=infra",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Upstreams, []string{"c", "d"})
+	check(t, c.Extras, []string{"x", "y"})
+	check(t, c.Labels, map[string]string{"env": "dev", "team": "infra"})
+	//defaults are never modified
+	check(t, defaults, []string{"a", "b"})
+}
+
+func TestSliceDefaultEnv(t *testing.T) {
+	os.Setenv("UPSTREAMS", "c,d")
+	defer os.Unsetenv("UPSTREAMS")
+	type Config struct {
+		Upstreams []string `opts:"sep,env=UPSTREAMS"`
+	}
+	c := &Config{Upstreams: []string{"a", "b"}}
+	if err := testNew(c).parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Upstreams, []string{"c", "d"})
+}
+
+func TestDocSliceDefault(t *testing.T) {
+	type Config struct {
+		Upstreams []string          `opts:"help=upstream servers"`
+		Ports     []int             `opts:"sep=;"`
+		Labels    map[string]string `opts:"short=-"`
+	}
+	c := &Config{
+		Upstreams: []string{"a", "b"},
+		Ports:     []int{80, 443},
+		Labels:    map[string]string{"team": "infra", "env": "dev"},
+	}
+	o, _ := New(c).Name("docslicedefault").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docslicedefault [options]
+
+  Options:
+  --upstream, -u  upstream servers (default a,b, allows multiple)
+  --port, -p      default 80;443, allows multiple
+  --label         key=value, default env=dev,team=infra, allows multiple
+  --help, -h      display help
+
+`)
+}
+
+func TestPointers(t *testing.T) {
+	type Config struct {
+		Retries *int
+		Name    *string
+		Debug   *bool
+		Timeout *time.Duration
+		Other   *int
+		File    *string `opts:"mode=arg"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--retries", "0", "--debug", "-t", "5s", "foo.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retries == nil || *c.Retries != 0 {
+		t.Fatalf("expected retries 0, got %v", c.Retries)
+	}
+	if c.Debug == nil || !*c.Debug {
+		t.Fatalf("expected debug true, got %v", c.Debug)
+	}
+	if c.Timeout == nil || *c.Timeout != 5*time.Second {
+		t.Fatalf("expected timeout 5s, got %v", c.Timeout)
+	}
+	if c.File == nil || *c.File != "foo.txt" {
+		t.Fatalf("expected file foo.txt, got %v", c.File)
+	}
+	if c.Name != nil || c.Other != nil {
+		t.Fatal("expected unset pointers to be nil")
+	}
+}
+
+func TestPointersDefault(t *testing.T) {
+	type Config struct {
+		Retries *int
+		Name    *string
+	}
+	retries, name := 3, "foo"
+	c := &Config{Retries: &retries, Name: &name}
+	err := testNew(c).parse([]string{"/bin/prog", "--retries", "9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retries == &retries || *c.Retries != 9 {
+		t.Fatalf("expected a new retries pointer to 9, got %v", c.Retries)
+	}
+	if retries != 3 {
+		t.Fatalf("expected default retries to be unchanged, got %d", retries)
+	}
+	if c.Name != &name || name != "foo" {
+		t.Fatal("expected unset default pointer to be kept")
+	}
+}
+
+func TestPointersEnvConfig(t *testing.T) {
+	os.Setenv("NAME", "from-env")
+	defer os.Unsetenv("NAME")
+	p := filepath.Join(os.TempDir(), "opts-pointers.json")
+	if err := ioutil.WriteFile(p, []byte(`{"retries":3}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Retries *int
+		Name    *string
+		Other   *string
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.UseEnv().ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Retries == nil || *c.Retries != 3 {
+		t.Fatalf("expected retries 3, got %v", c.Retries)
+	}
+	if c.Name == nil || *c.Name != "from-env" {
+		t.Fatalf("expected name from-env, got %v", c.Name)
+	}
+	if c.Other != nil {
+		t.Fatal("expected other to be nil")
+	}
+}
+
+func TestDocPointers(t *testing.T) {
+	type Config struct {
+		Retries *int `opts:"help=number of retries"`
+		Port    *int
+	}
+	port := 0
+	c := &Config{Port: &port}
+	o, _ := New(c).Name("docpointers").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docpointers [options]
+
+  Options:
+  --retries, -r  number of retries
+  --port, -p     default 0
+  --help, -h     display help
+
+`)
+}
+
+func TestSource(t *testing.T) {
+	os.Setenv("HOST", "example.com")
+	defer os.Unsetenv("HOST")
+	p := filepath.Join(os.TempDir(), "opts-source.json")
+	if err := ioutil.WriteFile(p, []byte(`{"user":"admin"}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Port    int
+		Host    string
+		User    string
+		Timeout int
+		File    string `opts:"mode=arg"`
+	}
+	c := &Config{Timeout: 30}
+	o, err := New(c).UseEnv().ConfigPath(p).ParseArgsError([]string{"/bin/prog", "--port", "9000", "foo.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, o.Source("port"), SourceFlag)
+	check(t, o.Source("Host"), SourceEnv)
+	check(t, o.Source("user"), SourceConfig)
+	check(t, o.Source("timeout"), SourceDefault)
+	check(t, o.Source("file"), SourceArg)
+	check(t, o.Source("missing"), SourceDefault)
+	check(t, o.IsSet("port"), true)
+	check(t, o.IsSet("Timeout"), false)
+	check(t, SourceEnv.String(), "env")
+}
+
+func TestSourceSubcommand(t *testing.T) {
+	type Config struct {
+		Cmd string `opts:"mode=cmdname"`
+		Foo struct {
+			Bar string
+		} `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	o, err := New(c).ParseArgsError([]string{"/bin/prog", "foo", "--bar", "zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, o.IsSet("bar"), false)
+	check(t, o.Selected().Source("bar"), SourceFlag)
+}
+
+func TestPrecedence(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-precedence.json")
+	if err := ioutil.WriteFile(p, []byte(`{"port":1}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	defer os.Unsetenv("PORT")
+	values := map[Source]int{SourceConfig: 1, SourceEnv: 2, SourceFlag: 3}
+	orders := [][]Source{
+		nil, //default
+		{SourceConfig, SourceEnv, SourceFlag},
+		{SourceConfig, SourceFlag, SourceEnv},
+		{SourceEnv, SourceConfig, SourceFlag},
+		{SourceEnv, SourceFlag, SourceConfig},
+		{SourceFlag, SourceConfig, SourceEnv},
+		{SourceFlag, SourceEnv, SourceConfig},
+	}
+	for _, order := range orders {
+		//every combination of provided sources
+		for mask := 0; mask < 8; mask++ {
+			provided := map[Source]bool{
+				SourceConfig: mask&1 != 0,
+				SourceEnv:    mask&2 != 0,
+				SourceFlag:   mask&4 != 0,
+			}
+			type Config struct {
+				Port int `opts:"env"`
+			}
+			c := &Config{}
+			n := testNew(c)
+			if order != nil {
+				n.Precedence(order...)
+			}
+			if provided[SourceConfig] {
+				n.ConfigPath(p)
+			}
+			if provided[SourceEnv] {
+				os.Setenv("PORT", "2")
+			} else {
+				os.Unsetenv("PORT")
+			}
+			args := []string{"/bin/prog"}
+			if provided[SourceFlag] {
+				args = append(args, "--port", "3")
+			}
+			if err := n.parse(args); err != nil {
+				t.Fatal(err)
+			}
+			//expect the highest provided source
+			ranked := order
+			if ranked == nil {
+				ranked = []Source{SourceConfig, SourceEnv, SourceFlag}
+			}
+			expected := SourceDefault
+			for _, s := range ranked {
+				if provided[s] {
+					expected = s
+				}
+			}
+			if n.Source("port") != expected || c.Port != values[expected] {
+				t.Fatalf("order %v provided %v: got %d (%s), expected %d (%s)",
+					ranked, provided, c.Port, n.Source("port"), values[expected], expected)
+			}
+		}
+	}
+}
+
+func TestPrecedenceMerge(t *testing.T) {
+	os.Setenv("LABELS", "team=env,zone=env")
+	defer os.Unsetenv("LABELS")
+	p := filepath.Join(os.TempDir(), "opts-precedence-merge.json")
+	b := []byte(`{"labels":{"env":"config","team":"config"},"tags":["x","y"],"file":"config.txt"}`)
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Labels map[string]string `opts:"env=LABELS"`
+		Tags   []string
+		File   string `opts:"mode=arg"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog", "--label", "zone=flag", "--tag", "z", "file.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	//maps merge, slices are replaced
+	check(t, c.Labels, map[string]string{"env": "config", "team": "env", "zone": "flag"})
+	check(t, c.Tags, []string{"z"})
+	check(t, c.File, "file.txt")
+}
+
+func TestPrecedenceInvalid(t *testing.T) {
+	type Config struct {
+		Foo string
+	}
+	_, err := New(&Config{}).Precedence(SourceEnv, SourceFlag).ParseArgsError([]string{"/bin/prog"})
+	if _, ok := err.(*AuthorError); !ok {
+		t.Fatalf("expected authorError, got: %T: %v", err, err)
+	}
+}
+
+func TestConfigDotEnv(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.env")
+	b := []byte("# comment\nMAX_CONNS=12\nexport NAME=\"hello world\"\ntags=a|b\n")
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		MaxConns int
+		Name     string
+		Tags     []string `opts:"sep=|"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.MaxConns, 12)
+	check(t, c.Name, "hello world")
+	check(t, c.Tags, []string{"a", "b"})
+	if s := n.Source("max-conns"); s != SourceConfig {
+		t.Fatalf("expected config source, got %s", s)
+	}
+}
+
+func TestConfigDecoder(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.kv")
+	b := []byte("max-conns: 3\nname: bob\n")
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	//a trivial "key: value" decoder
+	kv := ConfigDecoderFunc(func(b []byte) (map[string]interface{}, error) {
+		m := map[string]interface{}{}
+		for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			kv := strings.SplitN(l, ": ", 2)
+			if len(kv) != 2 {
+				return nil, errors.New("bad line")
+			}
+			m[kv[0]] = kv[1]
+		}
+		return m, nil
+	})
+	type Config struct {
+		MaxConns int
+		Name     string
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p).ConfigDecoder("kv", kv)
+	if err := n.parse([]string{"/bin/prog", "--name", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.MaxConns, 3)
+	check(t, c.Name, "alice")
+	//explicit format
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(p).ConfigFormat("json")
+	if err := n.parse([]string{"/bin/prog"}); err == nil || !strings.Contains(err.Error(), "invalid config file") {
+		t.Fatalf("expected invalid config file error, got %v", err)
+	}
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(p).ConfigFormat("ini")
+	if err := n.parse([]string{"/bin/prog"}); err == nil || !strings.Contains(err.Error(), "no decoder registered for format 'ini'") {
+		t.Fatalf("expected missing decoder error, got %v", err)
+	}
+	//well-known extensions are not assumed to be json
+	y := filepath.Join(os.TempDir(), "opts-test.yml")
+	if err := ioutil.WriteFile(y, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(y)
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(y)
+	if err := n.parse([]string{"/bin/prog"}); err == nil || err.Error() != "no decoder registered for format 'yaml' (see ConfigDecoder)" {
+		t.Fatalf("expected missing yaml decoder error, got %v", err)
+	}
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(y).ConfigDecoder("yaml", kv)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Name, "bob")
+}
+
+func TestConfigFlagNames(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.json")
+	b := []byte(`{"max-conns": 5, "log_level": "debug"}`)
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		MaxConns int
+		LogLevel string
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.MaxConns, 5)
+	check(t, c.LogLevel, "debug")
+}
+
+func TestConfigSubcommand(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.json")
+	b := []byte(`{"verbose": true, "serve": {"port": 80, "host": "example.com"}, "build": {"out": "bin"}}`)
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Serve struct {
+		Port int
+		Host string
+	}
+	type Build struct {
+		Out string
+	}
+	type Config struct {
+		Verbose bool
+		Serve   `opts:"mode=cmd"`
+		Build   `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p).ConfigStrict()
+	if err := n.parse([]string{"/bin/prog", "serve", "--port", "8080"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, true)
+	check(t, c.Serve.Port, 8080)
+	check(t, c.Serve.Host, "example.com")
+	check(t, c.Build.Out, "") //unused command
+	if s := n.cmd.Source("host"); s != SourceConfig {
+		t.Fatalf("expected config source, got %s", s)
+	}
+}
+
+func TestConfigUnknown(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.json")
+	b := []byte(`{"foo": "bar", "serve": {"prot": 80}}`)
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Serve struct {
+		Port int
+	}
+	type Config struct {
+		Foo   string
+		Serve `opts:"mode=cmd"`
+	}
+	//warnings only
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog", "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "bar")
+	//strict
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(p).ConfigStrict()
+	err := n.parse([]string{"/bin/prog", "serve"})
+	if err == nil || err.Error() != "config 'serve.prot' is unknown" {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestConfigJSONFields(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.json")
+	b := []byte(`{"listen_addr": ":80", "Secret": "s", "Port": 9, "nope": 1}`)
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Addr   string `json:"listen_addr"`
+		Secret string `opts:"-"`
+		Port   int
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog", "--port", "10"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Addr, ":80")
+	check(t, c.Secret, "s")
+	check(t, c.Port, 10)
+	//json names of flags use their precedence
+	if n.flagGroups[0].flags[0].source != SourceConfig {
+		t.Fatal("expected addr from config")
+	}
+	//only keys which match nothing are unknown
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(p).ConfigStrict()
+	if err := ioutil.WriteFile(p, []byte(`{"dump-config": true}`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	n.UserDumpConfig()
+	if err := n.parse([]string{"/bin/prog"}); err == nil || err.Error() != "config 'dump-config' is unknown" {
+		t.Fatalf("expected internal flag to be unknown, got %v", err)
+	}
+	c = &Config{}
+	n = testNew(c)
+	n.ConfigPath(p).ConfigStrict()
+	if err := ioutil.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := n.parse([]string{"/bin/prog"})
+	if err == nil || err.Error() != "config 'nope' is unknown" {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.env")
+	ioutil.WriteFile(a, []byte(`{"foo": "a", "bar": 1, "serve": {"port": 80, "host": "a.com"}}`), 0644)
+	ioutil.WriteFile(b, []byte("bar=2\n"), 0644)
+	type Serve struct {
+		Port int
+		Host string
+	}
+	type Config struct {
+		Foo   string
+		Bar   int
+		Serve `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPaths(a, filepath.Join(dir, "missing.json"), b)
+	if err := n.parse([]string{"/bin/prog", "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "a")
+	check(t, c.Bar, 2) //b overrides a
+	check(t, c.Serve.Port, 80)
+	check(t, n.configLoaded, []string{a, b})
+}
+
+func TestConfigPathsMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	ioutil.WriteFile(a, []byte(`{"serve": {"port": 80, "host": "a.com"}}`), 0644)
+	ioutil.WriteFile(b, []byte(`{"serve": {"port": 81}}`), 0644)
+	type Serve struct {
+		Port int
+		Host string
+	}
+	type Config struct {
+		Serve `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPaths(a, b)
+	if err := n.parse([]string{"/bin/prog", "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Serve.Port, 81)
+	check(t, c.Serve.Host, "a.com")
+}
+
+func TestXDGConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+	if err := os.Mkdir(filepath.Join(dir, "prog"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "prog", "config.json")
+	ioutil.WriteFile(f, []byte(`{"foo": "xdg", "bar": 1}`), 0644)
+	p := filepath.Join(dir, "override.json")
+	ioutil.WriteFile(p, []byte(`{"bar": 2}`), 0644)
+	type Config struct {
+		Foo string
+		Bar int
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.Name("prog").XDGConfig().ConfigPath(p)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "xdg")
+	check(t, c.Bar, 2)
+	check(t, n.configLoaded, []string{f, p})
+}
+
+func TestDocConfigFiles(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-test.json")
+	if err := ioutil.WriteFile(p, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Foo string
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docconfig").
+		ConfigPaths(p, filepath.Join(os.TempDir(), "opts-missing.json")).
+		ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docconfig [options]
+
+  Options:
+  --foo, -f
+  --help, -h          display help
+  --config-debug, -c  print which config files were loaded
+
+  Config files:
+    `+p+`
+
+`)
+}
+
+func TestUserConfigPathMissing(t *testing.T) {
+	type Config struct {
+		Foo string
+	}
+	p := filepath.Join(os.TempDir(), "opts-missing.json")
+	//missing default path is ignored
+	c := &Config{}
+	n := testNew(c)
+	n.ConfigPath(p).UserConfigPath()
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	//missing user path is an error
+	c = &Config{}
+	n = testNew(c)
+	n.UserConfigPath()
+	err := n.parse([]string{"/bin/prog", "--config-path", p})
+	if err == nil || err.Error() != "config file not found: "+p {
+		t.Fatalf("expected config file not found error, got %v", err)
+	}
+}
+
+func TestDumpConfig(t *testing.T) {
+	type Serve struct {
+		Port int `opts:"help=listening port"`
+	}
+	type Config struct {
+		Name    string `opts:"help=your name"`
+		Tags    []string
+		Labels  map[string]string
+		Timeout time.Duration
+		Retries *int
+		Serve   `opts:"mode=cmd,help=start the server"`
+	}
+	os.Setenv("NAME", "env")
+	defer os.Unsetenv("NAME")
+	c := &Config{Timeout: 5 * time.Second}
+	c.Serve.Port = 80
+	o, err := New(c).UseEnv().ParseArgsError([]string{"/bin/prog", "--tag", "a", "--label", "x=y", "serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := o.DumpConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, s, `{
+  // your name
+  "name": "env",
+  "tag": ["a"],
+  "label": {"x":"y"},
+  "timeout": "5s",
+  "retries": null,
+  // start the server
+  "serve": {
+    // listening port
+    "port": 80
+  }
+}
+`)
+	//dumped config can be loaded
+	p := filepath.Join(os.TempDir(), "opts-dump.json")
+	if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	c2 := &Config{}
+	if _, err := New(c2).ConfigPath(p).ConfigStrict().ParseArgsError([]string{"/bin/prog", "serve"}); err != nil {
+		t.Fatal(err)
+	}
+	c.Serve.Port = 80
+	check(t, c2, c)
+}
+
+func TestDumpConfigDotEnv(t *testing.T) {
+	type Config struct {
+		Name string `opts:"help=your name"`
+		Num  int
+		Tags []string `opts:"sep=|"`
+	}
+	c := &Config{Name: "hello world", Num: 7, Tags: []string{"a", "b"}}
+	o, err := New(c).ConfigFormat("env").ParseArgsError([]string{"/bin/prog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := o.DumpConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, s, `# your name
+NAME="hello world"
+NUM=7
+TAG=a|b
+`)
+}
+
+func TestDumpConfigFlag(t *testing.T) {
+	type Config struct {
+		Foo string
+		Bar int
+	}
+	c := &Config{Bar: 3}
+	_, err := New(c).UserDumpConfig().ParseArgsError([]string{"/bin/prog", "--foo", "x", "--dump-config"})
+	if !errors.Is(err, ErrDumpConfig) {
+		t.Fatalf("expected ErrDumpConfig, got %v", err)
+	}
+	check(t, err.Error(), `{
+  "foo": "x",
+  "bar": 3
+}
+`)
+}
+
+func TestDumpConfigSubcommand(t *testing.T) {
+	type Serve struct {
+		Port int `opts:"required"`
+	}
+	type Config struct {
+		Foo   string
+		Serve Serve `opts:"mode=cmd"`
+	}
+	for _, args := range [][]string{
+		{"/bin/prog", "--foo", "x", "--dump-config", "serve", "--port", "8"},
+		{"/bin/prog", "--foo", "x", "serve", "--port", "8", "--dump-config"},
+	} {
+		c := &Config{}
+		_, err := New(c).UserDumpConfig().ParseArgsError(args)
+		if !errors.Is(err, ErrDumpConfig) {
+			t.Fatalf("%v: expected ErrDumpConfig, got %v", args, err)
+		}
+		check(t, err.Error(), `{
+  "foo": "x",
+  "serve": {
+    "port": 8
+  }
+}
+`)
+	}
+	//required flags do not block the dump
+	c := &Config{}
+	_, err := New(c).UserDumpConfig().ParseArgsError([]string{"/bin/prog", "serve", "--dump-config"})
+	if !errors.Is(err, ErrDumpConfig) {
+		t.Fatalf("expected ErrDumpConfig, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = time.Second }()
+	p := filepath.Join(os.TempDir(), "opts-watch.json")
+	write := func(s string) {
+		if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"foo": "a", "bar": 1, "zip": "z", "num": 1}`)
+	defer os.Remove(p)
+	type Config struct {
+		Foo string
+		Bar int
+		Zip string
+		Zap string
+		Num int
+	}
+	c := &Config{Zap: "default"}
+	o, err := New(c).ConfigPath(p).ParseArgsError([]string{"/bin/prog", "--bar", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []string)
+	go o.Watch(ctx, func(changed []string) {
+		changes <- changed
+	})
+	wait := func() []string {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for change")
+		}
+		return nil
+	}
+	//flags are never changed, removed keys revert to defaults
+	write(`{"foo": "b", "bar": 3, "zap": "zzz", "num": 1}`)
+	check(t, wait(), []string{"foo", "zip", "zap"})
+	o.RLock()
+	check(t, *c, Config{Foo: "b", Bar: 2, Zip: "", Zap: "zzz", Num: 1})
+	o.RUnlock()
+	//invalid config is rolled back
+	write(`{"foo": "c", "num": "x"}`)
+	time.Sleep(100 * time.Millisecond)
+	o.RLock()
+	check(t, *c, Config{Foo: "b", Bar: 2, Zip: "", Zap: "zzz", Num: 1})
+	o.RUnlock()
+	write(`{"foo": "d", "zap": "zzz", "num": 2}`)
+	check(t, wait(), []string{"foo", "num"})
+	o.RLock()
+	check(t, *c, Config{Foo: "d", Bar: 2, Zip: "", Zap: "zzz", Num: 2})
+	o.RUnlock()
+}
+
+func TestWatchSubcommand(t *testing.T) {
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = time.Second }()
+	p := filepath.Join(os.TempDir(), "opts-watch-subcommand.json")
+	if err := ioutil.WriteFile(p, []byte(`{"foo": "a", "serve": {"port": 9}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Serve struct {
+		Port int
+	}
+	type Config struct {
+		Foo   string
+		Serve Serve `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	o, err := New(c).ConfigPath(p).ParseArgsError([]string{"/bin/prog", "serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Serve.Port, 9)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []string)
+	go o.Watch(ctx, func(changed []string) {
+		changes <- changed
+	})
+	//removed sections revert to defaults
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(p, []byte(`{"foo": "a"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-changes:
+		check(t, changed, []string{"serve.port"})
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	o.RLock()
+	check(t, *c, Config{Foo: "a"})
+	o.RUnlock()
+}
+
+func TestWatchPrecedence(t *testing.T) {
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = time.Second }()
+	os.Setenv("FOO", "env")
+	defer os.Unsetenv("FOO")
+	p := filepath.Join(os.TempDir(), "opts-watch-precedence.json")
+	if err := ioutil.WriteFile(p, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Foo string
+	}
+	c := &Config{}
+	o, err := New(c).UseEnv().ConfigPath(p).Precedence(SourceEnv, SourceConfig, SourceFlag).ParseArgsError([]string{"/bin/prog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Foo, "env")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []string)
+	go o.Watch(ctx, func(changed []string) {
+		changes <- changed
+	})
+	//config now has a higher precedence than env
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(p, []byte(`{"foo": "config"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-changes:
+		check(t, changed, []string{"foo"})
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	o.RLock()
+	check(t, c.Foo, "config")
+	o.RUnlock()
+}
+
+func TestWatchFlags(t *testing.T) {
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = time.Second }()
+	p := filepath.Join(os.TempDir(), "opts-watch-flags.json")
+	write := func(s string) {
+		if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{}`)
+	defer os.Remove(p)
+	type Config struct {
+		Foo string
+		Num int
+	}
+	c := &Config{}
+	errs := make(chan error)
+	o, err := New(c).ConfigPath(p).
+		Precedence(SourceFlag, SourceEnv, SourceConfig).
+		WatchError(func(err error) { errs <- err }).
+		ParseArgsError([]string{"/bin/prog", "--foo", "flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []string)
+	go o.Watch(ctx, func(changed []string) {
+		changes <- changed
+	})
+	wait := func() []string {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for change")
+		}
+		return nil
+	}
+	//config has a higher precedence than flags
+	time.Sleep(50 * time.Millisecond)
+	write(`{"foo": "config"}`)
+	check(t, wait(), []string{"foo"})
+	o.RLock()
+	check(t, c.Foo, "config")
+	o.RUnlock()
+	//removed keys revert to the flag value
+	write(`{"num": 1}`)
+	check(t, wait(), []string{"foo", "num"})
+	o.RLock()
+	check(t, *c, Config{Foo: "flag", Num: 1})
+	o.RUnlock()
+	//reload errors are passed to WatchError
+	write(`{"num": "x"}`)
+	select {
+	case err := <-errs:
+		if _, ok := err.(*InvalidValueError); !ok {
+			t.Fatalf("expected invalid value error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for error")
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	os.Setenv("MYAPP_CMD", "serve")
+	os.Setenv("MYAPP_VERBOSE", "true")
+	os.Setenv("MYAPP_SERVE_PORT", "8080")
+	os.Setenv("PORT", "1")
+	os.Setenv("HOST", "ignored")
+	defer os.Unsetenv("MYAPP_CMD")
+	defer os.Unsetenv("MYAPP_VERBOSE")
+	defer os.Unsetenv("MYAPP_SERVE_PORT")
+	defer os.Unsetenv("PORT")
+	defer os.Unsetenv("HOST")
+	type Serve struct {
+		Port int
+		Host string `opts:"env=HOST_NAME"`
+	}
+	type Config struct {
+		Cmd     string `opts:"mode=cmdname, env"`
+		Verbose bool
+		Serve   `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.EnvPrefix("MYAPP")
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Cmd, "serve")
+	check(t, c.Verbose, true)
+	check(t, c.Serve.Port, 8080)
+	check(t, c.Serve.Host, "")
+}
+
+func TestDocEnvPrefix(t *testing.T) {
+	type Config struct {
+		Port int
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docenvprefix").EnvPrefix("MYAPP_").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docenvprefix [options]
+
+  Options:
+  --port, -p  env MYAPP_PORT
+  --help, -h  display help
+
+`)
+}
+
+func TestArgEnv(t *testing.T) {
+	os.Setenv("FILE", "env.txt")
+	os.Setenv("RESTS", "a,b,c")
+	defer os.Unsetenv("FILE")
+	defer os.Unsetenv("RESTS")
+	type Config struct {
+		File  string   `opts:"mode=arg,env"`
+		Rests []string `opts:"mode=arg,env=RESTS,min=2"`
+	}
+	//from env
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.File, "env.txt")
+	check(t, c.Rests, []string{"a", "b", "c"})
+	//args override env
+	c = &Config{}
+	n := testNew(c)
+	if err := n.parse([]string{"/bin/prog", "arg.txt", "d", "e"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.File, "arg.txt")
+	check(t, c.Rests, []string{"d", "e"})
+	check(t, n.Source("file"), SourceArg)
+}
+
+func TestUseEnvInherited(t *testing.T) {
+	os.Setenv("VERBOSE", "true")
+	os.Setenv("PORT", "8080")
+	os.Setenv("DIR", "/srv")
+	defer os.Unsetenv("VERBOSE")
+	defer os.Unsetenv("PORT")
+	defer os.Unsetenv("DIR")
+	type Serve struct {
+		Port int
+		Dir  string `opts:"mode=arg"`
+	}
+	type Config struct {
+		Verbose bool
+	}
+	c := &Config{}
+	s := &Serve{}
+	o, err := New(c).UseEnv().AddCommand(New(s).Name("serve")).ParseArgsError([]string{"/bin/prog", "serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, true)
+	check(t, s.Port, 8080)
+	check(t, s.Dir, "/srv")
+	check(t, o.Selected().Source("dir"), SourceEnv)
+}
+
+func TestDocArgEnv(t *testing.T) {
+	type Config struct {
+		File string `opts:"mode=arg,env,help=input file"`
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docargenv").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docargenv [options] <file>
+
+  input file (env FILE)
+
+  Options:
+  --help, -h  display help
+
+`)
+}
+
+func TestDotEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, ".env")
+	b := filepath.Join(dir, ".env.local")
+	ioutil.WriteFile(a, []byte("HOST=localhost\nPORT=80\nexport URL=\"http://${HOST}:${PORT}\"\nRAW='${HOST}'\nCMD=serve\n"), 0644)
+	ioutil.WriteFile(b, []byte("PORT=8080 # override\n"), 0644)
+	os.Setenv("HOST", "example.com")
+	defer os.Unsetenv("HOST")
+	type Serve struct {
+		URL  string
+		Raw  string
+		Port int
+	}
+	type Config struct {
+		Cmd   string `opts:"mode=cmdname,env"`
+		Host  string
+		Serve `opts:"mode=cmd"`
+	}
+	c := &Config{}
+	n := testNew(c)
+	n.UseEnv().DotEnv(a, filepath.Join(dir, "missing.env"), b)
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Cmd, "serve")
+	check(t, c.Host, "example.com") //real env wins
+	check(t, c.Serve.URL, "http://example.com:80")
+	check(t, c.Serve.Raw, "${HOST}")
+	check(t, c.Serve.Port, 8080)
+	if _, ok := os.LookupEnv("PORT"); ok {
+		t.Fatal("process environment should not be modified")
+	}
+}
+
+func TestFileFlag(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "opts-secret")
+	if err := ioutil.WriteFile(p, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(p)
+	type Config struct {
+		Password string `opts:"file,required"`
+	}
+	//--password-file
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--password-file", p}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "hunter2")
+	//@path
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--password", "@" + p}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "hunter2")
+	//@@ escape
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--password", "@@foo"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "@foo")
+	//env values are used as-is
+	os.Setenv("PASSWORD", "@secret")
+	c = &Config{}
+	n := testNew(c)
+	n.UseEnv()
+	if err := n.parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "@secret")
+	os.Unsetenv("PASSWORD")
+	//PASSWORD_FILE
+	os.Setenv("PASSWORD_FILE", p)
+	defer os.Unsetenv("PASSWORD_FILE")
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "hunter2")
+	//flags override env
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--password", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Password, "x")
+	//mutually exclusive
+	c = &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--password", "x", "--password-file", p})
+	if err == nil || err.Error() != "--password and --password-file cannot be used together" {
+		t.Fatalf("expected mutual exclusion error, got %v", err)
+	}
+	//missing file
+	c = &Config{}
+	err = testNew(c).parse([]string{"/bin/prog", "--password-file", p + "-missing"})
+	if err == nil || !strings.Contains(err.Error(), "flag 'password-file' is invalid") {
+		t.Fatalf("expected missing file error, got %v", err)
+	}
+}
+
+func TestDocFileFlag(t *testing.T) {
+	type Config struct {
+		Password string `opts:"file,help=database password"`
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docfile").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docfile [options]
+
+  Options:
+  --password, -p   database password (or @path to read from a file)
+  --password-file  read --password from a file (env PASSWORD_FILE)
+  --help, -h       display help
+
+`)
+}
+
+func TestXor(t *testing.T) {
+	type Config struct {
+		File  string `opts:"oneof=input"`
+		URL   string `opts:"oneof=input"`
+		Stdin bool   `opts:"oneof=input"`
+		JSON  bool   `opts:"xor=format"`
+		YAML  bool   `opts:"xor=format"`
+	}
+	for _, testcase := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--file", "a"}, ""},
+		{[]string{"--stdin", "--yaml"}, ""},
+		{[]string{}, "one of --file, --url, --stdin is required"},
+		{[]string{"--file", "a", "--url", "b"}, "only one of --file, --url, --stdin can be set (got --file, --url)"},
+		{[]string{"--stdin", "--json", "--yaml"}, "only one of --json, --yaml can be set (got --json, --yaml)"},
+	} {
+		c := &Config{}
+		err := testNew(c).parse(append([]string{"/bin/prog"}, testcase.args...))
+		if testcase.err == "" && err != nil {
+			t.Fatalf("args %v: %s", testcase.args, err)
+		} else if testcase.err != "" && (err == nil || err.Error() != testcase.err) {
+			t.Fatalf("args %v: expected error %q, got %v", testcase.args, testcase.err, err)
+		}
+	}
+}
+
+func TestXorEnv(t *testing.T) {
+	os.Setenv("URL", "http://example.com")
+	defer os.Unsetenv("URL")
+	type Config struct {
+		File string `opts:"xor=input"`
+		URL  string `opts:"xor=input,env"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--file", "a"})
+	if err == nil || err.Error() != "only one of --file, --url can be set (got --file, --url)" {
+		t.Fatalf("expected xor error, got %v", err)
+	}
+}
+
+func TestXorMixed(t *testing.T) {
+	type Config struct {
+		JSON bool `opts:"xor=format"`
+		YAML bool `opts:"oneof=format"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog"})
+	if err == nil || !strings.Contains(err.Error(), "flag set 'format' cannot use both xor and oneof") {
+		t.Fatalf("expected flag set error, got %v", err)
+	}
+}
+
+func TestDocXor(t *testing.T) {
+	type Config struct {
+		File string `opts:"oneof=input"`
+		URL  string `opts:"oneof=input"`
+		JSON bool   `opts:"xor=format"`
+		YAML bool   `opts:"xor=format"`
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docxor").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docxor [options]
+
+  Options:
+  --file, -f
+  --url, -u
+  --json, -j
+  --yaml, -y
+  --help, -h  display help
+
+  Constraints:
+  exactly one of --file, --url
+  at most one of --json, --yaml
+
+`)
+}
+
+func TestRequiresImplies(t *testing.T) {
+	type Config struct {
+		TLSCert string
+		TLSKey  string `opts:"requires=tls-cert"`
+		Debug   bool   `opts:"implies=verbose|trace"`
+		Verbose bool   `opts:"negatable"`
+		Trace   bool
+	}
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--tls-cert", "c", "--tls-key", "k"}); err != nil {
+		t.Fatal(err)
+	}
+	c = &Config{}
+	err := testNew(c).parse([]string{"/bin/prog", "--tls-key", "k"})
+	if err == nil || err.Error() != "flag --tls-key requires --tls-cert" {
+		t.Fatalf("expected requires error, got %v", err)
+	}
+	//implies
+	c = &Config{}
+	n := testNew(c)
+	if err := n.parse([]string{"/bin/prog", "--debug"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, true)
+	check(t, c.Trace, true)
+	//explicit flags are not overridden
+	c = &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--debug", "--no-verbose"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, false)
+	check(t, c.Trace, true)
+}
+
+func TestImpliesEnv(t *testing.T) {
+	os.Setenv("VERBOSE", "false")
+	defer os.Unsetenv("VERBOSE")
+	type Config struct {
+		Debug   bool `opts:"implies=verbose"`
+		Verbose bool `opts:"env"`
+	}
+	//flags override env
+	c := &Config{}
+	if err := testNew(c).parse([]string{"/bin/prog", "--debug"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, c.Verbose, true)
+}
+
+func TestRequiresUnknown(t *testing.T) {
+	type Config struct {
+		Foo string `opts:"requires=bar"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog"})
+	if _, ok := err.(*AuthorError); !ok || err.Error() != "flag 'foo' requires unknown flag 'bar'" {
+		t.Fatalf("expected author error, got %v", err)
+	}
+	type Config2 struct {
+		Foo bool `opts:"implies=bar"`
+		Bar string
+	}
+	c2 := &Config2{}
+	err = testNew(c2).parse([]string{"/bin/prog"})
+	if _, ok := err.(*AuthorError); !ok || err.Error() != "flag 'foo' implies 'bar', which must be a bool" {
+		t.Fatalf("expected author error, got %v", err)
+	}
+}
+
+func TestDocRequiresImplies(t *testing.T) {
+	type Config struct {
+		TLSCert string
+		TLSKey  string `opts:"requires=tls-cert,help=key file"`
+		Debug   bool   `opts:"implies=verbose"`
+		Verbose bool
+	}
+	c := &Config{}
+	o, _ := New(c).Name("docdeps").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docdeps [options]
+
+  Options:
+  --tls-cert, -t
+  --tls-key       key file (requires --tls-cert)
+  --debug, -d     implies --verbose
+  --verbose, -v
+  --help, -h      display help
+
+`)
+}
+
+func TestRules(t *testing.T) {
+	type Config struct {
+		Port    int           `opts:"min=1,max=65535"`
+		Ratio   float64       `opts:"max=1.5"`
+		Timeout time.Duration `opts:"min=1s"`
+		Name    string        `opts:"pattern=^[a-z]+$,len=2-5"`
+		Tags    []string      `opts:"min=1,max=2,pattern=^#"`
+		Region  string        `opts:"nonempty"`
+		File    string        `opts:"mode=arg,len=-4"`
+	}
+	for _, testcase := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--region", "us", "--port", "80", "--name", "abc", "--tag", "#a", "f"}, ""},
+		{[]string{"f"}, "flag --region must not be empty (nonempty)"},
+		{[]string{"--region", "us", "--port", "0", "f"}, "flag --port must be at least 1 (min)"},
+		{[]string{"--region", "us", "--port", "70000", "f"}, "flag --port must be at most 65535 (max)"},
+		{[]string{"--region", "us", "--ratio", "2", "f"}, "flag --ratio must be at most 1.5 (max)"},
+		{[]string{"--region", "us", "--timeout", "10ms", "f"}, "flag --timeout must be at least 1s (min)"},
+		{[]string{"--region", "us", "--name", "ABC", "f"}, "flag --name must match ^[a-z]+$ (pattern)"},
+		{[]string{"--region", "us", "--name", "abcdef", "f"}, "flag --name must have a length of 2-5 (len)"},
+		{[]string{"--region", "us", "--tag", "#a", "--tag", "b", "f"}, "flag --tag must match ^# (pattern)"},
+		{[]string{"--region", "us", "--tag", "#a", "--tag", "#b", "--tag", "#c", "f"}, "flag --tag must have at most 2 values (max)"},
+		{[]string{"--region", "us", "files"}, "argument 'file' must have a length of at most 4 (len)"},
+	} {
+		c := &Config{}
+		err := testNew(c).parse(append([]string{"/bin/prog"}, testcase.args...))
+		if testcase.err == "" && err != nil {
+			t.Fatalf("args %v: %s", testcase.args, err)
+		} else if testcase.err != "" && (err == nil || err.Error() != testcase.err) {
+			t.Fatalf("args %v: expected error %q, got %v", testcase.args, testcase.err, err)
+		}
+	}
+}
+
+func TestRulesEnv(t *testing.T) {
+	os.Setenv("PORT", "0")
+	defer os.Unsetenv("PORT")
+	type Config struct {
+		Port int `opts:"min=1,env"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog"})
+	if err == nil || err.Error() != "flag --port must be at least 1 (min)" {
+		t.Fatalf("expected min error, got %v", err)
+	}
+}
+
+func TestRulesInvalid(t *testing.T) {
+	type Config struct {
+		Foo bool `opts:"min=1"`
+	}
+	c := &Config{}
+	err := testNew(c).parse([]string{"/bin/prog"})
+	if err == nil || !strings.Contains(err.Error(), "min on 'foo' requires a number or a slice") {
+		t.Fatalf("expected author error, got %v", err)
+	}
+	type Config2 struct {
+		Foo int `opts:"len=1"`
+	}
+	c2 := &Config2{}
+	err = testNew(c2).parse([]string{"/bin/prog"})
+	if err == nil || !strings.Contains(err.Error(), "len on 'foo' requires a string, slice or map") {
+		t.Fatalf("expected author error, got %v", err)
+	}
+}
+
+func TestDocRules(t *testing.T) {
+	type Config struct {
+		Port int    `opts:"min=1,max=65535,help=listening port"`
+		Name string `opts:"pattern=^[a-z]+$,len=2-"`
+		User string `opts:"nonempty"`
+		File string `opts:"mode=arg,len=-255"`
+	}
+	c := &Config{Port: 80, User: "root"}
+	o, _ := New(c).Name("docrules").ParseArgsError([]string{"/bin/prog", "--help"})
+	check(t, o.Help(), `
+  Usage: docrules [options] <file>
+
+  length at most 255
+
+  Options:
+  --port, -p  listening port (min 1, max 65535, default 80)
+  --name, -n  pattern ^[a-z]+$, length at least 2
+  --user, -u  non-empty, default root
+  --help, -h  display help
+
+`)
+}
+
+type testRange struct {
+	Min int
+	Max int
+}
+
+func (r *testRange) Validate() error {
+	if r.Min > r.Max {
+		return errors.New("min must not exceed max")
+	}
+	return nil
+}
+
+type testEven int
+
+func (e testEven) Validate() error {
+	if e%2 != 0 {
+		return errors.New("must be even")
+	}
+	return nil
+}
+
+type testServe struct {
+	Host string
+	TLS  bool
+}
+
+func (s testServe) Validate() error {
+	if s.TLS && s.Host == "" {
+		return errors.New("tls requires a host")
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	type Config struct {
+		Range testRange
+		Even  testEven
+	}
+	for _, testcase := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"/bin/prog", "--min", "1", "--max", "2", "--even", "4"}, ""},
+		{[]string{"/bin/prog", "--min", "3", "--max", "2"}, "min must not exceed max"},
+		{[]string{"/bin/prog", "--min", "3", "--max", "2", "--even", "3"}, "flag --even is invalid: must be even"},
+		{[]string{"/bin/prog", "serve", "--tls"}, "tls requires a host"},
+		{[]string{"/bin/prog", "serve", "--tls", "--host", "example.com"}, ""},
+	} {
+		c := &Config{}
+		o, err := New(c).AddCommand(New(&testServe{}).Name("serve")).ParseArgsError(testcase.args)
+		if testcase.err == "" {
+			if err != nil {
+				t.Fatalf("%v: unexpected error: %s", testcase.args, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != testcase.err {
+			t.Fatalf("%v: expected error %q, got %v", testcase.args, testcase.err, err)
+		}
+		//shown with the help text
+		if !strings.Contains(o.Help(), "Error:\n    "+testcase.err) {
+			t.Fatalf("%v: expected error in help, got:\n%s", testcase.args, o.Help())
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	type Serve struct {
+		Port int
+		Dir  string `opts:"mode=arg"`
+	}
+	type Config struct {
+		Verbose bool
+	}
+	parse := func(args ...string) (*node, error) {
+		c := &Config{}
+		s := New(&Serve{}).Name("serve")
+		o, err := New(c).Version("1.2.3").AddCommand(s).ParseArgsError(append([]string{"/bin/prog"}, args...))
+		return o.(*node), err
+	}
+	//help and version
+	if _, err := parse("--help"); !errors.Is(err, ErrHelp) || errors.Is(err, ErrVersion) {
+		t.Fatalf("expected ErrHelp, got %v", err)
+	}
+	if _, err := parse("--version"); !errors.Is(err, ErrVersion) || err.Error() != "1.2.3" {
+		t.Fatalf("expected ErrVersion, got %v", err)
+	}
+	//help of a subcommand
+	o, err := parse("serve", "--help")
+	var he *HelpError
+	if !errors.As(err, &he) || !errors.Is(err, ErrHelp) {
+		t.Fatalf("expected help error, got %T: %v", err, err)
+	}
+	if he.Opts != o.cmd || err.Error() != o.cmd.Help() {
+		t.Fatalf("expected help error to carry the subcommand")
+	}
+	//unknown flag in a subcommand
+	o, err = parse("serve", "--nope")
+	var uf *UnknownFlagError
+	if !errors.As(err, &uf) || uf.Flag != "--nope" {
+		t.Fatalf("expected unknown flag error, got %T: %v", err, err)
+	}
+	if uf.Opts != o.cmd || !strings.Contains(uf.Opts.Help(), "unknown flag: --nope") {
+		t.Fatalf("expected error to carry the subcommand")
+	}
+	//missing argument
+	var ma *MissingArgError
+	if _, err := parse("serve"); !errors.As(err, &ma) || ma.Arg != "dir" || ma.Opts == nil {
+		t.Fatalf("expected missing arg error, got %T: %v", err, err)
+	}
+	//invalid value
+	var iv *InvalidValueError
+	_, err = parse("serve", "--port", "abc", "/tmp")
+	if !errors.As(err, &iv) || iv.Flag != "port" || iv.Value != "abc" || errors.Unwrap(err) != iv.Err {
+		t.Fatalf("expected invalid value error, got %T: %v", err, err)
+	}
+	if err.Error() != `invalid value "abc" for flag --port: expected integer` {
+		t.Fatalf("unexpected message: %s", err)
+	}
+	//author error
+	type Bad struct {
+		Foo string `opts:"bar"`
+	}
+	var ae *AuthorError
+	if _, err := New(&Bad{}).ParseArgsError([]string{"/bin/prog"}); !errors.As(err, &ae) || ae.Opts == nil {
+		t.Fatalf("expected author error, got %T: %v", err, err)
+	}
+}
+
+func TestErrorsSubcommand(t *testing.T) {
+	type Deploy struct {
+		Env  string `opts:"required"`
+		Host string
+		JSON bool `opts:"xor=format"`
+		YAML bool `opts:"xor=format"`
+	}
+	type Config struct {
+		Cmd string `opts:"mode=cmdname"`
+	}
+	parse := func(cmd string, args ...string) (*node, error) {
+		c := &Config{Cmd: cmd}
+		o, err := New(c).
+			AddCommand(New(&Deploy{}).Name("deploy")).
+			AddCommand(New(&testServe{}).Name("serve")).
+			ParseArgsError(append([]string{"/bin/prog"}, args...))
+		return o.(*node), err
+	}
+	//each error carries the subcommand which failed
+	for _, testcase := range []struct {
+		args   []string
+		target interface{}
+		err    string
+	}{
+		{[]string{"deploy"}, new(*MissingFlagError), "missing required flag: --env"},
+		{[]string{"deploy", "--env", "x", "--json", "--yaml"}, new(*ConstraintError), "only one of --json, --yaml can be set (got --json, --yaml)"},
+		{[]string{"deploy", "--env", "x", "--host"}, new(*InvalidValueError), "flag needs an argument: --host"},
+		{[]string{"deploy", "--env", "x", "extra"}, new(*UnexpectedArgsError), "unexpected arguments: extra"},
+		{[]string{"serve", "--tls"}, new(*ValidateError), "tls requires a host"},
+	} {
+		o, err := parse("", testcase.args...)
+		if err == nil || err.Error() != testcase.err || !errors.As(err, testcase.target) {
+			t.Fatalf("%v: expected %T %q, got %T: %v", testcase.args, testcase.target, testcase.err, err, err)
+		}
+		oe, ok := err.(optsError)
+		if !ok || oe.opts() != o.cmd {
+			t.Fatalf("%v: expected error to carry the subcommand", testcase.args)
+		}
+		if !strings.Contains(o.cmd.Help(), testcase.err) {
+			t.Fatalf("%v: expected error in subcommand help", testcase.args)
+		}
+	}
+	//unknown default command
+	var uc *UnknownCommandError
+	if o, err := parse("nope"); !errors.As(err, &uc) || uc.Command != "nope" || uc.Opts != o {
+		t.Fatalf("expected unknown command error, got %T: %v", err, err)
+	}
+	//missing config file
+	var ce *ConfigError
+	p := filepath.Join(os.TempDir(), "opts-missing.json")
+	_, err := New(&Config{}).UserConfigPath().ParseArgsError([]string{"/bin/prog", "--config-path", p})
+	if !errors.As(err, &ce) || ce.File != p || !os.IsNotExist(ce.Err) {
+		t.Fatalf("expected config error, got %T: %v", err, err)
+	}
+}
+
 func testNew(config interface{}) *node {
 	o := New(config)
 	n := o.(*node)
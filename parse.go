@@ -1,6 +1,10 @@
 package opts
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // parseFlags parses command-line flags from args using the provided flag map.
 // When stopAtNonFlag is true, parsing stops at the first non-flag argument
@@ -41,7 +45,7 @@ func parseFlags(flags map[string]*item, args []string, stopAtNonFlag bool) (rema
 			name = name[1:]
 		}
 		if name == "" {
-			return remaining, fmt.Errorf("bad flag syntax: %s", arg)
+			return remaining, &UnknownFlagError{Flag: arg, msg: "bad flag syntax: " + arg}
 		}
 		// handle --flag=value
 		value := ""
@@ -52,21 +56,49 @@ func parseFlags(flags map[string]*item, args []string, stopAtNonFlag bool) (rema
 			hasValue = true
 		}
 		if name == "" {
-			return remaining, fmt.Errorf("bad flag syntax: %s", arg)
+			return remaining, &UnknownFlagError{Flag: arg, msg: "bad flag syntax: " + arg}
 		}
 		item, ok := flags[name]
+		// negated bool flag: --no-<name>
+		if !ok && strings.HasPrefix(name, "no-") {
+			if item, ok = flags[name[3:]]; ok && item.negatable {
+				if hasValue {
+					err := errors.New("does not take a value")
+					return remaining, invalidValue(item, value, err, "flag %s %s", arg, err)
+				}
+				if err := item.Set("false"); err != nil {
+					return remaining, invalidValue(item, "false", err, "invalid value \"false\" for flag %s: %s", arg, err)
+				}
+				i++
+				continue
+			}
+			ok = false
+		}
+		// single dash cluster of short flags: -xvf or -n5
+		if !ok && arg[1] != '-' && len(arg) > 2 {
+			consumed, err := parseShortFlags(flags, arg, args[i+1:])
+			if err != nil {
+				return remaining, err
+			}
+			i += 1 + consumed
+			continue
+		}
 		if !ok {
-			return remaining, fmt.Errorf("unknown flag: %s", arg)
+			return remaining, &UnknownFlagError{Flag: arg}
 		}
 		// bool flags don't consume next arg
 		if item.IsBoolFlag() {
-			if hasValue {
-				if err := item.Set(value); err != nil {
-					return remaining, fmt.Errorf("invalid value %q for flag %s: %s", value, arg, err)
+			if item.counter && !hasValue {
+				if err := item.inc(); err != nil {
+					return remaining, invalidValue(item, "", err, "flag %s %s", arg, err)
+				}
+			} else if hasValue {
+				if err := item.setFlag(value); err != nil {
+					return remaining, invalidValue(item, value, err, "invalid value %q for flag %s: %s", value, arg, err)
 				}
 			} else {
 				if err := item.Set("true"); err != nil {
-					return remaining, fmt.Errorf("invalid value \"true\" for flag %s: %s", arg, err)
+					return remaining, invalidValue(item, "true", err, "invalid value \"true\" for flag %s: %s", arg, err)
 				}
 			}
 			i++
@@ -74,22 +106,71 @@ func parseFlags(flags map[string]*item, args []string, stopAtNonFlag bool) (rema
 		}
 		// non-bool flag needs a value
 		if hasValue {
-			if err := item.Set(value); err != nil {
-				return remaining, fmt.Errorf("invalid value %q for flag %s: %s", value, arg, err)
+			if err := item.setFlag(value); err != nil {
+				return remaining, invalidValue(item, value, err, "invalid value %q for flag %s: %s", value, arg, err)
 			}
 			i++
 		} else if i+1 < len(args) {
-			if err := item.Set(args[i+1]); err != nil {
-				return remaining, fmt.Errorf("invalid value %q for flag %s: %s", args[i+1], arg, err)
+			if err := item.setFlag(args[i+1]); err != nil {
+				return remaining, invalidValue(item, args[i+1], err, "invalid value %q for flag %s: %s", args[i+1], arg, err)
 			}
 			i += 2
 		} else {
-			return remaining, fmt.Errorf("flag needs an argument: %s", arg)
+			return remaining, missingValue(item, arg)
 		}
 	}
 	return
 }
 
+// parseShortFlags expands a cluster of single character flags.
+// Each bool flag is set to true, and the first flag which needs
+// a value takes the rest of the cluster, or otherwise the next arg.
+func parseShortFlags(flags map[string]*item, arg string, next []string) (consumed int, err error) {
+	shorts := arg[1:]
+	for j := 0; j < len(shorts); j++ {
+		short := "-" + shorts[j:j+1]
+		item, ok := flags[shorts[j:j+1]]
+		if !ok {
+			if j == 0 {
+				return 0, &UnknownFlagError{Flag: arg}
+			}
+			return 0, &UnknownFlagError{Flag: short, msg: fmt.Sprintf("unknown flag: %s in %s", short, arg)}
+		}
+		if item.counter {
+			if err := item.inc(); err != nil {
+				return 0, invalidValue(item, "", err, "flag %s %s", short, err)
+			}
+			continue
+		}
+		if item.IsBoolFlag() {
+			if err := item.Set("true"); err != nil {
+				return 0, invalidValue(item, "true", err, "invalid value \"true\" for flag %s: %s", short, err)
+			}
+			continue
+		}
+		// attached value: -n5 or -n=5
+		if rest := strings.TrimPrefix(shorts[j+1:], "="); rest != "" {
+			if err := item.setFlag(rest); err != nil {
+				return 0, invalidValue(item, rest, err, "invalid value %q for flag %s: %s", rest, short, err)
+			}
+			return 0, nil
+		}
+		if len(next) == 0 {
+			return 0, missingValue(item, short)
+		}
+		if err := item.setFlag(next[0]); err != nil {
+			return 0, invalidValue(item, next[0], err, "invalid value %q for flag %s: %s", next[0], short, err)
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
+
+//missingValue is a flag given without its value
+func missingValue(i *item, flag string) error {
+	return invalidValue(i, "", errors.New("needs an argument"), "flag needs an argument: %s", flag)
+}
+
 func indexOf(s string, c byte) int {
 	for i := 0; i < len(s); i++ {
 		if s[i] == c {
@@ -2,8 +2,10 @@ package opts
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -28,6 +30,27 @@ func camel2const(s string) string {
 	return strings.ReplaceAll(b.String(), "-", "_")
 }
 
+//splitEscaped splits s on each sep, except
+//where sep is escaped with a backslash
+func splitEscaped(s, sep string) []string {
+	parts := []string{}
+	sb := strings.Builder{}
+	for len(s) > 0 {
+		if strings.HasPrefix(s, `\`+sep) {
+			sb.WriteString(sep)
+			s = s[1+len(sep):]
+		} else if strings.HasPrefix(s, sep) {
+			parts = append(parts, sb.String())
+			sb.Reset()
+			s = s[len(sep):]
+		} else {
+			sb.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return append(parts, sb.String())
+}
+
 func nletters(r rune, n int) string {
 	str := make([]rune, n)
 	for i := range str {
@@ -312,3 +335,30 @@ func newKV(s string) *kv {
 	commit()
 	return &kv{m: m}
 }
+
+//parseRange parses "n" (exactly n), "n-m" (n to m),
+//"n-" (at least n) and "-m" (at most m). unbounded
+//maximums are returned as -1.
+func parseRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) == 1 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("expected a length or range (e.g. 1-10)")
+		}
+		return n, n, nil
+	}
+	min, max := 0, -1
+	var err error
+	if parts[0] != "" {
+		if min, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, 0, fmt.Errorf("expected a length or range (e.g. 1-10)")
+		}
+	}
+	if parts[1] != "" {
+		if max, err = strconv.Atoi(parts[1]); err != nil || max < min {
+			return 0, 0, fmt.Errorf("expected a length or range (e.g. 1-10)")
+		}
+	}
+	return min, max, nil
+}
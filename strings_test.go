@@ -96,3 +96,27 @@ func TestCamel2Dash(t *testing.T) {
 	}
 
 }
+
+func TestSplitEscaped(t *testing.T) {
+	for _, testcase := range []struct {
+		input  string
+		sep    string
+		output []string
+	}{
+		{"a,b,c", ",", []string{"a", "b", "c"}},
+		{"a", ",", []string{"a"}},
+		{"", ",", []string{""}},
+		{`a\,b,c`, ",", []string{"a,b", "c"}},
+		{`a\b;c`, ";", []string{`a\b`, "c"}},
+		{"a::b", "::", []string{"a", "b"}},
+	} {
+		got := splitEscaped(testcase.input, testcase.sep)
+		if !reflect.DeepEqual(got, testcase.output) {
+			t.Fatalf("input: %s\n  expected: %q\n       got: %q",
+				testcase.input,
+				testcase.output,
+				got,
+			)
+		}
+	}
+}